@@ -0,0 +1,145 @@
+// Package embedding runs Vamos code from Go programs.
+//
+// An Interpreter evaluates code in a top-level environment of its own, and
+// converts values between Go and Vamos:
+//
+//	v := embedding.New()
+//	v.EvalString(`(def square (proc (x) (* x x)))`)
+//	result, err := v.Call("square", 12) // 144.0, nil
+//
+// Go functions can be made available to Vamos code with Register:
+//
+//	v.Register("shout", strings.ToUpper)
+//	result, err = v.EvalString(`(shout "hello")`) // "HELLO", nil
+//
+// Values are converted by reflection:
+//
+//	Go                         Vamos
+//	bool                       true or false
+//	ints, uints and floats     number
+//	string                     string
+//	slices and arrays          list
+//	maps                       list of (key value) lists, sorted by key
+//	error                      error, as bound by the catch clause of 'try'
+//	funcs                      procedure
+//	nil                        nil
+//	anything else              Go value
+//
+// Any ast.Node is passed through unchanged. A Go value, such as a pointer to
+// a struct, is opaque to Vamos code, which can only pass it around, or use it
+// with the go-call, go-field and go-type primitives:
+//
+//	v.Call("handle", request) // (proc (req) (go-call req 'FormValue "id"))
+//
+// Where no Go type is asked for, such as for the results of EvalString and
+// Call, numbers become float64, lists []interface{}, Go values the value they
+// wrap, and values with no Go counterpart, such as symbols and procedures, are
+// returned as their ast.Node.
+//
+// A Go function called from Vamos code may return an error as its last
+// result. If it is not nil, it is raised as a Vamos error, which can be
+// caught with 'try'. An error raised by Vamos code and not caught is returned
+// to Go as an *interpreter.EvalError.
+//
+// The prelude is not loaded by New. Load it with LoadFile if it is needed.
+// An Interpreter must not be used by more than one goroutine at once.
+package embedding
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/interpreter"
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/util"
+)
+
+// An Interpreter evaluates Vamos code for a Go program.
+type Interpreter struct {
+	in *interpreter.Interpreter
+}
+
+// New creates an interpreter which writes output to standard output and
+// reads input from standard input.
+func New() *Interpreter {
+	return NewWithIO(os.Stdout, os.Stdin)
+}
+
+// NewWithIO creates an interpreter which writes output to w and reads lines
+// of input from r.
+func NewWithIO(w io.Writer, r io.Reader) *Interpreter {
+	reader := bufio.NewReader(r)
+	readLine := func() string {
+		line, _ := reader.ReadString('\n')
+		return line
+	}
+	return &Interpreter{in: interpreter.New(w, readLine)}
+}
+
+// EvalString evaluates the forms in a string of Vamos code, returning the
+// value of the last one.
+func (v *Interpreter) EvalString(code string) (interface{}, error) {
+	return v.eval(code, "eval-string")
+}
+
+// LoadFile evaluates the forms in a file of Vamos code, such as the prelude,
+// returning the value of the last one.
+func (v *Interpreter) LoadFile(fileName string) (interface{}, error) {
+	content, err := util.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return v.eval(content, fileName)
+}
+
+func (v *Interpreter) eval(code string, sourceName string) (interface{}, error) {
+	nodes, parseErrors := parser.Parse(code, sourceName)
+	if parseErrors.Len() != 0 {
+		return nil, errors.New(parseErrors.String())
+	}
+
+	var result interface{}
+	for _, n := range nodes {
+		value, err := v.in.Eval(n)
+		if err != nil {
+			return nil, err
+		}
+		result = interpreter.FromValue(value)
+	}
+	return result, nil
+}
+
+// Call calls the procedure or primitive with the given name, converting the
+// arguments to Vamos values and the result back to a Go value.
+func (v *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	f, ok := v.in.Env().Get(ast.Intern(name))
+	if !ok {
+		return nil, errors.New("Name not defined: " + name)
+	}
+
+	values := make(ast.Nodes, len(args))
+	for i, arg := range args {
+		values[i] = interpreter.ToValue(arg)
+	}
+
+	result, err := v.in.Apply(f, values)
+	if err != nil {
+		return nil, err
+	}
+	return interpreter.FromValue(result), nil
+}
+
+// Register defines a primitive with the given name, which calls a Go
+// function. The arguments it is called with are converted to the types of
+// the function's parameters, and its result to a Vamos value. The function
+// may return nothing, a value, an error, or a value and an error.
+func (v *Interpreter) Register(name string, fn interface{}) error {
+	p, err := interpreter.NewGoPrimitive(name, fn)
+	if err != nil {
+		return err
+	}
+	return v.in.Define(name, p)
+}
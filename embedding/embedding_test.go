@@ -0,0 +1,279 @@
+package embedding
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/interpreter"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+func newTestInterpreter() (*Interpreter, *bytes.Buffer) {
+	var out bytes.Buffer
+	return NewWithIO(&out, strings.NewReader("a line\n")), &out
+}
+
+func checkResult(t *testing.T, expected interface{}, actual interface{}, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected <%#v> but got <%#v>", expected, actual)
+	}
+}
+
+func TestEvalString(t *testing.T) {
+	v, out := newTestInterpreter()
+
+	result, err := v.EvalString(`(println "hi") (list 1 "two" \3 true nil (list))`)
+	checkResult(t, []interface{}{1.0, "two", '3', true, nil, []interface{}{}}, result, err)
+	testhelp.CheckEqualString(t, "hi\n", out.String())
+
+	result, err = v.EvalString(`(read-line)`)
+	checkResult(t, "a line", result, err)
+
+	if _, err := v.EvalString(`(+ 1`); err == nil {
+		t.Errorf("Expected a parse error")
+	}
+	if _, err := v.EvalString(`undefined-name`); err == nil {
+		t.Errorf("Expected an evaluation error")
+	} else if _, ok := err.(*interpreter.EvalError); !ok {
+		t.Errorf("Expected an *interpreter.EvalError but got <%#v>", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	v, _ := newTestInterpreter()
+	v.EvalString(`(def join (proc (a b) (concat a b)))`)
+
+	result, err := v.Call("join", []int{1, 2}, [2]string{"x", "y"})
+	checkResult(t, []interface{}{1.0, 2.0, "x", "y"}, result, err)
+
+	result, err = v.Call("list", map[string]int{"b": 2, "a": 1}, false, uint8(7), 2.5)
+	checkResult(t, []interface{}{
+		[]interface{}{[]interface{}{"a", 1.0}, []interface{}{"b", 2.0}},
+		false, 7.0, 2.5,
+	}, result, err)
+
+	if _, err := v.Call("undefined-name"); err == nil || err.Error() != "Name not defined: undefined-name" {
+		t.Errorf("Expected an undefined name error but got <%v>", err)
+	}
+	if _, err := v.Call("join", 1); err == nil {
+		t.Errorf("Expected an arity error")
+	}
+	result, err = v.Call("go-type", make(chan int))
+	checkResult(t, "chan int", result, err)
+}
+
+type account struct {
+	Owner   string
+	Balance int
+	secret  string
+}
+
+func (a *account) Deposit(amount int) int {
+	a.Balance += amount
+	return a.Balance
+}
+
+func (a *account) Withdraw(amount int) error {
+	if amount > a.Balance {
+		return errors.New("Insufficient funds")
+	}
+	a.Balance -= amount
+	return nil
+}
+
+func (a account) Describe(prefixes ...string) string {
+	return strings.Join(prefixes, "") + a.Owner
+}
+
+func TestGoValues(t *testing.T) {
+	v, _ := newTestInterpreter()
+	a := &account{Owner: "ann", Balance: 10, secret: "x"}
+	v.Register("the-account", func() *account { return a })
+
+	result, err := v.EvalString(`(typeof (the-account))`)
+	checkResult(t, ast.Intern("*embedding.account"), result, err)
+	result, err = v.EvalString(`(go-type (the-account))`)
+	checkResult(t, "*embedding.account", result, err)
+
+	result, err = v.EvalString(`(go-call (the-account) 'Deposit 5)`)
+	checkResult(t, 15.0, result, err)
+	if a.Balance != 15 {
+		t.Errorf("Expected the balance to be 15 but got %v", a.Balance)
+	}
+
+	result, err = v.EvalString(`(list (go-field (the-account) 'Owner) (go-field (the-account) "Balance"))`)
+	checkResult(t, []interface{}{"ann", 15.0}, result, err)
+
+	result, err = v.EvalString(`(go-call (the-account) 'Describe "Dear " "Ms. ")`)
+	checkResult(t, "Dear Ms. ann", result, err)
+
+	result, err = v.EvalString(`(try (go-call (the-account) 'Withdraw 100) (catch e (error-message e)))`)
+	checkResult(t, "Insufficient funds", result, err)
+
+	result, err = v.EvalString(`(= (the-account) (the-account))`)
+	checkResult(t, true, result, err)
+
+	// A Go value passed back to Go is the value it wraps
+	result, err = v.Call("the-account")
+	checkResult(t, a, result, err)
+
+	for _, input := range []string{
+		`(go-call (the-account) 'Missing)`,
+		`(go-call (the-account) 'Deposit)`,
+		`(go-call (the-account) 'Deposit "5")`,
+		`(go-field (the-account) 'secret)`,
+		`(go-field (the-account) 'Missing)`,
+		`(go-call 5 'Deposit 1)`,
+	} {
+		if _, err := v.EvalString(input); err == nil {
+			t.Errorf("Expected an error for <%v>", input)
+		}
+	}
+}
+
+func TestGoValues_Nil(t *testing.T) {
+	v, _ := newTestInterpreter()
+	v.Register("nil-value", func() *interpreter.GoValue { return interpreter.NewGoValue(nil) })
+	v.Register("is-nil", func(x interface{}) bool { return x == nil })
+
+	result, err := v.EvalString(`(list (typeof (nil-value)) (go-type (nil-value)) (is-nil (nil-value)) (= (nil-value) (nil-value)))`)
+	checkResult(t, []interface{}{ast.Intern("nil"), "nil", true, true}, result, err)
+
+	result, err = v.EvalString(`(try (go-call (nil-value) 'Deposit 1) (catch e (error-message e)))`)
+	checkResult(t, "Go value of type nil has no method: Deposit", result, err)
+
+	result, err = v.EvalString(`(try (go-field (nil-value) 'Owner) (catch e (error-message e)))`)
+	checkResult(t, "Go value of type nil is not a struct", result, err)
+}
+
+type holder struct {
+	Contents interface{}
+}
+
+func TestGoValues_Equals(t *testing.T) {
+	v, _ := newTestInterpreter()
+	v.Register("holder", func(contents interface{}) holder { return holder{Contents: contents} })
+	v.Register("account", func() account { return account{Owner: "ann"} })
+
+	result, err := v.EvalString(`(list (= (holder 1) (holder 1)) (= (holder 1) (holder 2)) (= (holder 1) (account)))`)
+	checkResult(t, []interface{}{true, false, false}, result, err)
+
+	// Lists are converted to slices, which cannot be compared
+	result, err = v.EvalString(`(try (= (holder (list 1)) (holder (list 1))) (catch e (error-message e)))`)
+	checkResult(t, "Cannot compare the values of Go values of type embedding.holder", result, err)
+}
+
+func TestRegister(t *testing.T) {
+	v, _ := newTestInterpreter()
+	checkRegister := func(name string, fn interface{}) {
+		t.Helper()
+		if err := v.Register(name, fn); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	checkRegister("shout", strings.ToUpper)
+	checkRegister("sum", func(ns ...int) int {
+		total := 0
+		for _, n := range ns {
+			total += n
+		}
+		return total
+	})
+	checkRegister("keys", func(m map[string]float64) []string {
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		return keys
+	})
+	checkRegister("negate", func(b bool) bool { return !b })
+	checkRegister("nothing", func() {})
+
+	result, err := v.EvalString(`(shout "hello")`)
+	checkResult(t, "HELLO", result, err)
+	result, err = v.EvalString(`(list (sum) (sum 1 2 3))`)
+	checkResult(t, []interface{}{0.0, 6.0}, result, err)
+	result, err = v.EvalString(`(keys (list (list "k" 1)))`)
+	checkResult(t, []interface{}{"k"}, result, err)
+	result, err = v.EvalString(`(negate false)`)
+	checkResult(t, true, result, err)
+	result, err = v.EvalString(`(nothing)`)
+	checkResult(t, nil, result, err)
+
+	for _, input := range []string{`(shout 1)`, `(sum 1.5)`, `(negate nil)`, `(shout)`} {
+		if _, err := v.EvalString(input); err == nil {
+			t.Errorf("Expected an error for <%v>", input)
+		}
+	}
+
+	if err := v.Register("shout", strings.ToLower); err == nil {
+		t.Errorf("Expected an error when redefining a name")
+	}
+	if err := v.Register("not-a-func", 1); err == nil {
+		t.Errorf("Expected an error for a value which is not a function")
+	}
+}
+
+func TestRegister_Errors(t *testing.T) {
+	v, _ := newTestInterpreter()
+	v.Register("divide", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("Division by zero")
+		}
+		return a / b, nil
+	})
+
+	result, err := v.EvalString(`(divide 7 2)`)
+	checkResult(t, 3.0, result, err)
+
+	result, err = v.EvalString(`(try (divide 1 0) (catch e (error-message e)))`)
+	checkResult(t, "Division by zero", result, err)
+
+	_, err = v.EvalString(`(divide 1 0)`)
+	if evalError, ok := err.(*interpreter.EvalError); !ok || evalError.Message != "Division by zero" {
+		t.Errorf("Expected a division by zero error but got <%v>", err)
+	}
+
+	// Errors pass between Go and Vamos in both directions
+	v.Register("describe", func(err error) string { return "Described: " + err.(*interpreter.EvalError).Message })
+	v.Register("make-error", func() error { return errors.New("Made in Go") })
+	result, err = v.EvalString(`(describe (try (make-error) (catch e e)))`)
+	checkResult(t, "Described: Made in Go", result, err)
+}
+
+func TestFuncs(t *testing.T) {
+	v, _ := newTestInterpreter()
+	v.Register("map-ints", func(f func(int) int, ns []int) []int {
+		var result []int
+		for _, n := range ns {
+			result = append(result, f(n))
+		}
+		return result
+	})
+	v.Register("try-call", func(f func() (string, error)) string {
+		s, err := f()
+		if err != nil {
+			return "failed: " + err.(*interpreter.EvalError).Message
+		}
+		return s
+	})
+
+	result, err := v.EvalString(`(map-ints (proc (n) (* n n)) (list 1 2 3))`)
+	checkResult(t, []interface{}{1.0, 4.0, 9.0}, result, err)
+
+	result, err = v.EvalString(`(list (try-call (proc () "ok")) (try-call (proc () (raise "bad"))))`)
+	checkResult(t, []interface{}{"ok", "failed: bad"}, result, err)
+
+	// A Go func passed to Vamos code can be called like a primitive
+	result, err = v.Call("apply", func(a, b string) string { return a + b }, []string{"x", "y"})
+	checkResult(t, "xy", result, err)
+}
@@ -28,8 +28,7 @@
 (defproc worker (cin cout)
   (let (w (take! cin))
     (if w
-      (let (x (first w)
-            y (first (rest w))
+      (let ((x y _) w
             z (* x y))
         (begin
           (sleep z)
@@ -0,0 +1,212 @@
+package ast
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/onlyafly/vamos/lang/token"
+)
+
+////////// LazySeq
+
+// ErrSelfDependent is what a LazySeq panics with when it is needed while it
+// is being realized, such as by the function which produces it.
+var ErrSelfDependent = errors.New("Lazy sequence depends on itself")
+
+// LazySeq is a sequence whose elements are only computed when they are
+// needed. It is produced by a function which returns the sequence as another
+// collection, typically a cons of its first element onto a LazySeq of the
+// rest, so a LazySeq may be infinite. The function is called at most once;
+// after that, the sequence remembers its first element and its rest. The
+// sequence cannot be needed while the function is running, whether by the
+// function itself or by another goroutine.
+type LazySeq struct {
+	mu        sync.Mutex
+	produce   func() Coll
+	realizing bool // Whether the function is being called
+	realized  bool
+	empty     bool
+	first     Node
+	rest      Coll
+}
+
+// NewLazySeq creates a sequence which is produced by a function the first
+// time it is needed.
+func NewLazySeq(produce func() Coll) *LazySeq {
+	return &LazySeq{produce: produce}
+}
+
+// realize produces the sequence if that has not been done yet. It panics with
+// ErrSelfDependent if the sequence is already being produced.
+func (ls *LazySeq) realize() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	for !ls.realized {
+		if ls.realizing {
+			panic(ErrSelfDependent)
+		}
+		coll := ls.produceUnlocked()
+
+		if inner, ok := coll.(*LazySeq); ok {
+			if inner == ls {
+				panic(ErrSelfDependent)
+			}
+
+			// Take over the state of the inner sequence rather than realizing it
+			// recursively, so that a long chain of sequences which each produce
+			// the next does not grow the stack
+			inner.mu.Lock()
+			realizing := inner.realizing
+			ls.produce, ls.realized, ls.empty, ls.first, ls.rest = inner.produce, inner.realized, inner.empty, inner.first, inner.rest
+			inner.mu.Unlock()
+			if realizing {
+				panic(ErrSelfDependent)
+			}
+			continue
+		}
+
+		ls.realized = true
+		ls.empty = coll.IsEmpty()
+		if !ls.empty {
+			ls.first = coll.First()
+			ls.rest = coll.Rest().(Coll)
+		}
+	}
+
+	ls.produce = nil
+}
+
+// produceUnlocked calls the function which produces the sequence without
+// holding the lock, which the function may need in order to find out that it
+// depends on the sequence itself. If the function panics, it may be called
+// again the next time the sequence is needed.
+func (ls *LazySeq) produceUnlocked() Coll {
+	ls.realizing = true
+	produce := ls.produce
+	ls.mu.Unlock()
+	defer func() {
+		ls.mu.Lock()
+		ls.realizing = false
+	}()
+
+	return produce()
+}
+
+func (ls *LazySeq) String() string {
+	return "(" + strings.Join(nodesToStrings(ls.Children()), " ") + ")"
+}
+
+func (ls *LazySeq) FriendlyString() string { return ls.String() }
+func (ls *LazySeq) isExpr() bool           { return true }
+func (ls *LazySeq) TypeName() string       { return "lazy_seq" }
+func (ls *LazySeq) Loc() *token.Location   { return nil }
+
+// RealizedString returns the elements of the sequence which have been
+// realized so far, followed by "..." if there may be more, without realizing
+// any more of it.
+func (ls *LazySeq) RealizedString() string {
+	var parts []string
+	for {
+		ls.mu.Lock()
+		realized, empty, first, rest := ls.realized, ls.empty, ls.first, ls.rest
+		ls.mu.Unlock()
+
+		if !realized {
+			parts = append(parts, "...")
+			break
+		}
+		if empty {
+			break
+		}
+		parts = append(parts, first.String())
+
+		next, ok := rest.(*LazySeq)
+		if !ok {
+			parts = append(parts, nodesToStrings(rest.Children())...)
+			break
+		}
+		ls = next
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// Equals compares the sequence element by element with any collection.
+func (ls *LazySeq) Equals(n Node) bool {
+	other, ok := n.(Coll)
+	if !ok {
+		return false
+	}
+
+	var coll Coll = ls
+	for {
+		if coll.IsEmpty() || other.IsEmpty() {
+			return coll.IsEmpty() && other.IsEmpty()
+		}
+		if !coll.First().Equals(other.First()) {
+			return false
+		}
+		coll, other = coll.Rest().(Coll), other.Rest().(Coll)
+	}
+}
+
+func (ls *LazySeq) IsEmpty() bool {
+	ls.realize()
+	return ls.empty
+}
+
+func (ls *LazySeq) First() Node {
+	if ls.IsEmpty() {
+		return &Nil{}
+	}
+	return ls.first
+}
+
+func (ls *LazySeq) Rest() Node {
+	if ls.IsEmpty() {
+		return ls
+	}
+	return ls.rest
+}
+
+// Length realizes the whole sequence, so it never returns for an infinite one.
+func (ls *LazySeq) Length() int {
+	length := 0
+	var coll Coll = ls
+	for !coll.IsEmpty() {
+		length++
+		coll = coll.Rest().(Coll)
+	}
+	return length
+}
+
+// Children realizes the whole sequence, so it never returns for an infinite
+// one.
+func (ls *LazySeq) Children() []Node {
+	children := []Node{}
+	var coll Coll = ls
+	for !coll.IsEmpty() {
+		children = append(children, coll.First())
+		coll = coll.Rest().(Coll)
+	}
+	return children
+}
+
+func (ls *LazySeq) Cons(elem Node) (Coll, error) {
+	return &LazySeq{realized: true, first: elem, rest: ls}, nil
+}
+
+// Append lazily appends another collection to the sequence.
+func (ls *LazySeq) Append(other Coll) (Coll, error) {
+	return appendLazily(ls, other), nil
+}
+
+func appendLazily(coll Coll, other Coll) *LazySeq {
+	return NewLazySeq(func() Coll {
+		if coll.IsEmpty() {
+			return other
+		}
+		return &LazySeq{realized: true, first: coll.First(), rest: appendLazily(coll.Rest().(Coll), other)}
+	})
+}
@@ -2,8 +2,12 @@ package ast
 
 import (
 	"fmt"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"weak"
 
 	"github.com/onlyafly/vamos/lang/token"
 )
@@ -100,6 +104,93 @@ type Symbol struct {
 	Name       string
 	annotation Node
 	Location   *token.Location
+	Alias      *Alias // Set if the symbol was renamed by a hygienic macro
+
+	interned *Symbol // The interned symbol with the same name, if this is a copy of it
+}
+
+// internedSymbols holds weak pointers to the symbols returned by Intern, by
+// name. A symbol which is no longer referred to is collected and its name
+// removed, so names which are used only for a while, such as those read by
+// read-string, do not fill the table for good.
+var internedSymbols sync.Map
+
+// Intern returns the one symbol with the given name, which is shared by every
+// occurrence of the name in parsed code and is the same as every other symbol
+// with the name. Its location is recorded by the list it occurs in rather than
+// by the symbol, and it must not be changed.
+//
+// A name containing a '#', which the reader does not allow, is one made by
+// gensym, and is not interned: the symbol returned is the same only as itself,
+// like the symbols gensym returns.
+func Intern(name string) *Symbol {
+	if strings.Contains(name, "#") {
+		return &Symbol{Name: name}
+	}
+
+	for {
+		if p, ok := internedSymbols.Load(name); ok {
+			if s := p.(weak.Pointer[Symbol]).Value(); s != nil {
+				return s
+			}
+			// The symbol has been collected, but its name not yet removed
+			internedSymbols.CompareAndDelete(name, p)
+			continue
+		}
+
+		s := &Symbol{Name: name}
+		p := weak.Make(s)
+		if _, loaded := internedSymbols.LoadOrStore(name, p); loaded {
+			continue
+		}
+		runtime.AddCleanup(s, func(name string) {
+			internedSymbols.CompareAndDelete(name, p)
+		}, name)
+		return s
+	}
+}
+
+// NewSymbol returns a copy of the interned symbol with the given name which
+// has a location of its own, if it is not nil, and may be given an annotation,
+// such as a symbol read outside any list. The copy is the same symbol as the
+// interned one.
+func NewSymbol(name string, loc *token.Location) *Symbol {
+	interned := Intern(name)
+	return &Symbol{Name: interned.Name, Location: loc, interned: interned}
+}
+
+// Interned returns the interned symbol which s is the same as. A symbol which
+// was neither returned by Intern nor copied from one by NewSymbol, such as one
+// made by gensym, is the same only as itself.
+func (s *Symbol) Interned() *Symbol {
+	if s.interned != nil {
+		return s.interned
+	}
+	return s
+}
+
+// Is reports whether two symbols are the same symbol, by comparing the
+// symbols they are interned as.
+func (s *Symbol) Is(other *Symbol) bool {
+	return s.Interned() == other.Interned()
+}
+
+// An Alias records what a symbol renamed by a hygienic macro stands for: the
+// symbol in the macro's template, and the environment the macro was defined
+// in, where references to the symbol which the expansion does not bind are
+// looked up.
+type Alias struct {
+	Original *Symbol
+	Scope    interface{}
+}
+
+// Base returns the symbol as it was written in the source, before any
+// renaming by hygienic macros.
+func (s *Symbol) Base() *Symbol {
+	for s.Alias != nil {
+		s = s.Alias.Original
+	}
+	return s
 }
 
 func (s *Symbol) String() string         { return displayAnnotation(s, s.Name) }
@@ -107,7 +198,7 @@ func (s *Symbol) FriendlyString() string { return s.String() }
 func (s *Symbol) isExpr() bool           { return true }
 func (s *Symbol) Annotation() Node       { return s.annotation }
 func (s *Symbol) SetAnnotation(n Node)   { s.annotation = n }
-func (s *Symbol) Equals(n Node) bool     { return s.Name == asSymbol(n).Name }
+func (s *Symbol) Equals(n Node) bool     { return s.Is(asSymbol(n)) }
 func (s *Symbol) TypeName() string       { return "symbol" }
 func (s *Symbol) Loc() *token.Location   { return s.Location }
 
@@ -168,8 +259,36 @@ type List struct {
 	Nodes      []Node
 	annotation Node
 	Location   *token.Location
+	Locations  []*token.Location // Where each of the nodes was read, if the list was parsed
+	expansion  atomic.Pointer[Expansion]
 }
 
+// LocOf returns where the node at position i of the list was read. An
+// interned symbol occurs in many places, so only the list records where.
+func (l *List) LocOf(i int) *token.Location {
+	if i < len(l.Locations) && l.Locations[i] != nil {
+		return l.Locations[i]
+	}
+	return l.Nodes[i].Loc()
+}
+
+// An Expansion is the form a list expanded into as a macro call, along with
+// the macro which expanded it and what the evaluator made of the form to run
+// it, if anything.
+type Expansion struct {
+	Macro    Node
+	Form     Node
+	Prepared interface{}
+}
+
+// Expansion returns the cached expansion of the list as a macro call, if any.
+func (l *List) Expansion() *Expansion { return l.expansion.Load() }
+
+// SetExpansion caches the expansion of the list as a macro call. A list may
+// be evaluated by several goroutines at once, so the cache is updated
+// atomically.
+func (l *List) SetExpansion(x *Expansion) { l.expansion.Store(x) }
+
 func NewList(nodes []Node) *List {
 	return &List{Nodes: nodes}
 }
@@ -185,6 +304,10 @@ func (l *List) SetAnnotation(n Node)   { l.annotation = n }
 func (l *List) TypeName() string       { return "list" }
 func (l *List) Loc() *token.Location   { return l.Location }
 func (l *List) Equals(n Node) bool {
+	if seq, ok := n.(*LazySeq); ok {
+		return seq.Equals(l)
+	}
+
 	other := asList(n)
 
 	// Compare lengths
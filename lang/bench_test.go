@@ -0,0 +1,130 @@
+package lang
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/interpreter"
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/util"
+)
+
+// benchmarkExample loads an example file and then measures how long it takes
+// to evaluate an expression which uses it, with each engine.
+func benchmarkExample(b *testing.B, fileName string, expression string) {
+	enterBaseDir()
+
+	content, err := util.ReadFile(fileName)
+	if err != nil {
+		b.Fatalf("Error reading file <%v>: %v", fileName, err)
+	}
+	benchmarkCode(b, content, fileName, expression)
+}
+
+// benchmarkCode evaluates some code and then measures how long it takes to
+// evaluate an expression which uses it, with each engine.
+func benchmarkCode(b *testing.B, content string, sourceName string, expression string) {
+	engines := []struct {
+		name   string
+		engine interpreter.Engine
+	}{
+		{"tree-walker", interpreter.TreeWalker},
+		{"bytecode-vm", interpreter.BytecodeVM},
+		{"closure-compiler", interpreter.ClosureCompiler},
+	}
+
+	for _, engine := range engines {
+		b.Run(engine.name, func(b *testing.B) {
+			var out bytes.Buffer
+			readLine := func() string { return "" }
+			in := interpreter.New(&out, readLine)
+			in.Engine = engine.engine
+			evalAll(b, in, content, sourceName)
+
+			nodes, _ := parser.Parse(expression, "benchmark")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := in.Eval(nodes[0]); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func evalAll(b *testing.B, in *interpreter.Interpreter, input string, sourceName string) {
+	nodes, errors := parser.Parse(input, sourceName)
+	if errors.Len() != 0 {
+		b.Fatalf("Error parsing <%v>: %v", sourceName, errors.String())
+	}
+	for _, n := range nodes {
+		if _, err := in.Eval(n); err != nil {
+			b.Fatalf("Error evaluating <%v>: %v", sourceName, err)
+		}
+	}
+}
+
+// Before evaluation was rewritten in continuation-passing style for call/cc,
+// the tree-walking evaluator ran the benchmarks below in about:
+//
+//	BenchmarkFib        2.9ms/op   1.6MB/op   30577 allocs/op
+//	BenchmarkFibIter    0.19ms/op  92KB/op    1718 allocs/op
+//
+// Comparing the engines with these shows what the continuations cost. Run
+// alternately with that evaluator on the same machine, the engines took:
+//
+//	                    tree-walker   bytecode-vm   closure-compiler
+//	BenchmarkFib        1.20x         1.01x         0.81x
+//	BenchmarkFibIter    0.77x         0.75x         0.65x
+//
+// of its time, with 27618, 21709 and 22698 allocs/op for BenchmarkFib.
+//
+// The virtual machine gives little speedup over the tree walker. Profiling
+// shows that the time of both goes mostly to allocating rather than to
+// dispatching on instructions or forms: the arguments and frame of each call,
+// and for the virtual machine an operand stack for each procedure body and a
+// copy of it each time a call returns to the body, which is needed because a
+// continuation captured by call/cc may be resumed more than once.
+
+func BenchmarkFib(b *testing.B) {
+	benchmarkExample(b, "examples/fib.v", "(fib 15)")
+}
+
+func BenchmarkFibIter(b *testing.B) {
+	benchmarkExample(b, "examples/fib.v", "(fib-iter 100)")
+}
+
+// lookupCode makes twenty references to parameters and let variables, at
+// depths of up to four environments out, for each procedure call, so that
+// BenchmarkVariableLookup mostly measures how variables are looked up: by
+// name through a chain of maps, or by slot in array-backed frames.
+const lookupCode = `
+(def make-summer
+  (proc (a b)
+    (let (c 3)
+      (proc (n)
+        (let (d 4)
+          (list a b c d n a b c d n a b c d n a b c d n))))))
+
+(def sum (make-summer 1 2))
+
+(def sum-times
+  (proc (n)
+    (if (= n 0)
+      0
+      (begin (sum n) (sum-times (- n 1))))))`
+
+// Run alternately with the evaluator before continuations, as for the
+// benchmarks above, the engines took:
+//
+//	                          tree-walker   bytecode-vm   closure-compiler
+//	BenchmarkVariableLookup   0.91x         0.63x         0.53x
+//
+// of its time, with 2610, 1717 and 2020 allocs/op against its 3111. The tree
+// walker looks variables up by name as that evaluator did, so most of the
+// difference between it and the other engines is what resolving variables to
+// slots saves.
+
+func BenchmarkVariableLookup(b *testing.B) {
+	benchmarkCode(b, lookupCode, "lookup.v", "(sum-times 100)")
+}
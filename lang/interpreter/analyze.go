@@ -0,0 +1,482 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Closure Compiler
+
+// An executor runs an analysed form in an environment, handing its value to
+// a continuation.
+type executor func(th *thread, e Env, k *continuation) packet
+
+// An analysis is a form translated into Go closures, which can be run any
+// number of times without looking at the form again.
+type analysis struct {
+	exec executor
+
+	// value, if not nil, computes the value of the form without a continuation.
+	// It is only given to forms which call no procedure, and which run nothing
+	// with side effects before they can fail, such as a call of a primitive
+	// whose arguments are constants and variables. It reports false when the
+	// form must be run by exec instead, such as when a name is undefined.
+	value func(th *thread, e Env) (ast.Node, bool)
+
+	// pure reports whether computing the value has no side effects, so it
+	// may be computed again by exec if something after it fails.
+	pure bool
+}
+
+// An analyzedBody is the analysed body of a procedure, which runs in a frame
+// with a slot for each of the procedure's parameters.
+type analyzedBody struct {
+	exec executor
+}
+
+// An analyzedProcedure is the parameter list and analysed body of a proc
+// form, which are shared by every procedure the form creates.
+type analyzedProcedure struct {
+	params *parameterList
+	body   *analyzedBody
+}
+
+// analyzeTopLevel analyses a top-level form. As with the bytecode compiler,
+// forms which the analyser does not translate itself, such as most special
+// forms and any form which is malformed, are left to the tree-walking
+// evaluator, so they raise the same errors at the same points.
+func analyzeTopLevel(n ast.Node) executor {
+	a := &analyzer{}
+	return a.analyze(n).exec
+}
+
+// analyzeBody analyses the body of a procedure. The scope is that of the
+// code the procedure is defined in, or nil if it is not known.
+func analyzeBody(params *parameterList, body ast.Node, parent *scope) *analyzedBody {
+	a := &analyzer{scope: &scope{names: params.frameNames, parent: parent}}
+	return &analyzedBody{exec: a.analyze(body).exec}
+}
+
+type analyzer struct {
+	scope *scope
+}
+
+func (a *analyzer) analyze(n ast.Node) analysis {
+	switch value := n.(type) {
+	case *ast.Number, *ast.Str, *ast.Char:
+		return constantAnalysis(value)
+	case *ast.Nil:
+		return analysis{
+			exec: func(th *thread, e Env, k *continuation) packet {
+				return resume(k, &ast.Nil{})
+			},
+			value: func(th *thread, e Env) (ast.Node, bool) {
+				return &ast.Nil{}, true
+			},
+			pure: true,
+		}
+	case *ast.Symbol:
+		return a.analyzeSymbol(value)
+	case *ast.List:
+		return a.analyzeList(value)
+	}
+	return evalAnalysis(n)
+}
+
+func constantAnalysis(n ast.Node) analysis {
+	return analysis{
+		exec: func(th *thread, e Env, k *continuation) packet {
+			return resume(k, n)
+		},
+		value: func(th *thread, e Env) (ast.Node, bool) {
+			return n, true
+		},
+		pure: true,
+	}
+}
+
+// evalAnalysis leaves a form to the tree-walking evaluator.
+func evalAnalysis(n ast.Node) analysis {
+	return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+		return evalNode(th, e, n, k)
+	}}
+}
+
+// analyzeSymbol resolves a variable to the slot of a frame if it is in a
+// known scope. A name which turns out to be undefined is left to the
+// evaluator, which signals the error.
+func (a *analyzer) analyzeSymbol(symbol *ast.Symbol) analysis {
+	var lookup func(e Env) (ast.Node, bool)
+	if depth, slot, ok := a.scope.resolve(symbol); ok {
+		lookup = func(e Env) (ast.Node, bool) {
+			if value := loadLocal(e, symbol, depth, slot); value != nil {
+				return value, true
+			}
+			// The slot has not been set yet, so the name is looked up as the
+			// evaluator would
+			return lookupSymbol(e, symbol)
+		}
+	} else {
+		depth := a.scope.depth()
+		lookup = func(e Env) (ast.Node, bool) {
+			return lookupPast(e, symbol, depth)
+		}
+	}
+
+	value := func(th *thread, e Env) (ast.Node, bool) {
+		result, ok := lookup(e)
+		if !ok {
+			return nil, false
+		}
+		if dv, ok := result.(*DynamicVar); ok {
+			return dynamicValue(th, dv), true
+		}
+		return result, true
+	}
+
+	return analysis{
+		exec: func(th *thread, e Env, k *continuation) packet {
+			if result, ok := value(th, e); ok {
+				return resume(k, result)
+			}
+			return evalNode(th, e, symbol, k)
+		},
+		value: value,
+		pure:  true,
+	}
+}
+
+func (a *analyzer) analyzeList(l *ast.List) analysis {
+	if len(l.Nodes) == 0 {
+		return evalAnalysis(l)
+	}
+
+	head := l.Nodes[0]
+	args := l.Nodes[1:]
+
+	symbol, ok := head.(*ast.Symbol)
+	if !ok || !isSpecialForm(symbol.Base().Name) {
+		return a.analyzeCall(l)
+	}
+
+	switch name := symbol.Base().Name; {
+	case name == "quote" && len(args) == 1:
+		return constantAnalysis(stripAliases(args[0]))
+	case name == "if" && len(args) == 3:
+		return a.analyzeIf(args)
+	case name == "cond" && len(args) >= 2 && len(args)%2 == 0:
+		return a.analyzeCond(head, args)
+	case name == "begin":
+		return a.analyzeSequence(args)
+	case name == "let" && len(args) == 2 && isBindingList(args[0]):
+		return a.analyzeLet(args)
+	case name == "def" && len(args) == 2 && isSymbol(args[0]):
+		name := toSymbol(args[0])
+		valueAnalysis := a.analyze(args[1])
+		return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+			if value, ok := valueAnalysis.valueNow(th, e); ok {
+				defineName(e, head, name, value)
+				return resume(k, &ast.Nil{})
+			}
+			return valueAnalysis.exec(th, e, then(th, func(th *thread, value ast.Node) packet {
+				defineName(e, head, name, value)
+				return resume(k, &ast.Nil{})
+			}))
+		}}
+	case name == "update!" && len(args) == 2 && isSymbol(args[0]):
+		target := args[0].(*ast.Symbol)
+		valueAnalysis := a.analyze(args[1])
+		return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+			if value, ok := valueAnalysis.valueNow(th, e); ok {
+				updateName(th, e, head, target, value)
+				return resume(k, &ast.Nil{})
+			}
+			return valueAnalysis.exec(th, e, then(th, func(th *thread, value ast.Node) packet {
+				updateName(th, e, head, target, value)
+				return resume(k, &ast.Nil{})
+			}))
+		}}
+	case name == "proc" && len(args) == 2:
+		procedures := a.analyzeProcedures(ast.Nodes{ast.NewList(args)})
+		return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+			f := newProcedure(e, l, args)
+			if procedures != nil {
+				procedures[0].attach(f)
+			}
+			return resume(k, f)
+		}}
+	case name == "case-proc" && len(args) >= 1:
+		procedures := a.analyzeProcedures(args)
+		return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+			f := newCaseProcedure(e, l, args)
+			if procedures != nil {
+				for i, clause := range f.Clauses {
+					procedures[i].attach(clause)
+				}
+			}
+			return resume(k, f)
+		}}
+	}
+	return evalAnalysis(l)
+}
+
+func (a *analyzer) analyzeIf(args []ast.Node) analysis {
+	test := a.analyze(args[0])
+	consequent := a.analyze(args[1])
+	alternative := a.analyze(args[2])
+
+	branch := func(th *thread, e Env, value ast.Node, k *continuation) packet {
+		if toBooleanValue(value) {
+			return consequent.exec(th, e, k)
+		}
+		return alternative.exec(th, e, k)
+	}
+
+	return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+		if value, ok := test.valueNow(th, e); ok {
+			return branch(th, e, value, k)
+		}
+		return test.exec(th, e, then(th, func(th *thread, value ast.Node) packet {
+			return branch(th, e, value, k)
+		}))
+	}}
+}
+
+func (a *analyzer) analyzeCond(head ast.Node, args []ast.Node) analysis {
+	tests := make([]analysis, 0, len(args)/2)
+	bodies := make([]analysis, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		tests = append(tests, a.analyze(args[i]))
+		bodies = append(bodies, a.analyze(args[i+1]))
+	}
+
+	var clause func(th *thread, e Env, i int, k *continuation) packet
+	clause = func(th *thread, e Env, i int, k *continuation) packet {
+		if i == len(tests) {
+			panicEvalError(head, "No matching cond clause: "+head.String())
+		}
+		if value, ok := tests[i].valueNow(th, e); ok {
+			if toBooleanValue(value) {
+				return bodies[i].exec(th, e, k)
+			}
+			return clause(th, e, i+1, k)
+		}
+		return tests[i].exec(th, e, then(th, func(th *thread, value ast.Node) packet {
+			if toBooleanValue(value) {
+				return bodies[i].exec(th, e, k)
+			}
+			return clause(th, e, i+1, k)
+		}))
+	}
+
+	return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+		return clause(th, e, 0, k)
+	}}
+}
+
+func (a *analyzer) analyzeSequence(ns []ast.Node) analysis {
+	if len(ns) == 0 {
+		return a.analyze(&ast.Nil{})
+	}
+
+	forms := make([]analysis, len(ns))
+	for i, n := range ns {
+		forms[i] = a.analyze(n)
+	}
+	last := len(forms) - 1
+
+	var form func(th *thread, e Env, i int, k *continuation) packet
+	form = func(th *thread, e Env, i int, k *continuation) packet {
+		for ; i < last; i++ {
+			if _, ok := forms[i].valueNow(th, e); !ok {
+				return forms[i].exec(th, e, then(th, func(th *thread, _ ast.Node) packet {
+					return form(th, e, i+1, k)
+				}))
+			}
+		}
+		return forms[last].exec(th, e, k)
+	}
+
+	return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+		return form(th, e, 0, k)
+	}}
+}
+
+func (a *analyzer) analyzeLet(args []ast.Node) analysis {
+	variableNodes := args[0].(*ast.List).Nodes
+
+	var names []*ast.Symbol
+	for i := 0; i < len(variableNodes); i += 2 {
+		names = patternNames(variableNodes[i], names)
+	}
+
+	// The values are analysed in the scope of the let, so that each may refer
+	// to the variables before it
+	outer := a.scope
+	a.scope = &scope{names: names, parent: outer}
+	defer func() { a.scope = outer }()
+
+	patterns := make([]ast.Node, 0, len(variableNodes)/2)
+	values := make([]analysis, 0, len(variableNodes)/2)
+	for i := 0; i < len(variableNodes); i += 2 {
+		patterns = append(patterns, variableNodes[i])
+		values = append(values, a.analyze(variableNodes[i+1]))
+	}
+	body := a.analyze(args[1])
+
+	var bind func(th *thread, e Env, i int, k *continuation) packet
+	bind = func(th *thread, e Env, i int, k *continuation) packet {
+		for ; i < len(patterns); i++ {
+			pattern := patterns[i]
+			if !isSymbol(pattern) {
+				checkPattern("Let variables", pattern, pattern)
+			}
+			value, ok := values[i].valueNow(th, e)
+			if !ok {
+				return values[i].exec(th, e, then(th, func(th *thread, value ast.Node) packet {
+					bindPattern(e, pattern, value)
+					return bind(th, e, i+1, k)
+				}))
+			}
+			bindPattern(e, pattern, value)
+		}
+		return body.exec(th, e, k)
+	}
+
+	return analysis{exec: func(th *thread, e Env, k *continuation) packet {
+		return bind(th, NewFrameEnv("let", names, e), 0, k)
+	}}
+}
+
+// analyzeProcedures analyses the bodies of procedures defined by clauses of
+// the form (params body). If any of the clauses is malformed, none is
+// analysed and nil is returned, leaving the error to be raised when the
+// procedure is created or called.
+func (a *analyzer) analyzeProcedures(clauses []ast.Node) []*analyzedProcedure {
+	analyzed := make([]*analyzedProcedure, len(clauses))
+	for i, clause := range clauses {
+		l, ok := clause.(*ast.List)
+		if !ok || len(l.Nodes) != 2 {
+			return nil
+		}
+		paramNodes, ok := l.Nodes[0].(ast.Coll)
+		if !ok {
+			return nil
+		}
+		params, ok := tryParseParameters(paramNodes.Children())
+		if !ok {
+			return nil
+		}
+		analyzed[i] = &analyzedProcedure{params: params, body: analyzeBody(params, l.Nodes[1], a.scope)}
+	}
+	return analyzed
+}
+
+// analyzeCall analyses a call of a routine, or of a macro, which can only be
+// told apart once the head has been evaluated. Simple primitives are called
+// straight away, and a call of one whose head and arguments have pure values
+// is itself given a value.
+func (a *analyzer) analyzeCall(l *ast.List) analysis {
+	head := l.Nodes[0]
+	argNodes := l.Nodes[1:]
+
+	headAnalysis := a.analyze(head)
+	args := make([]analysis, len(argNodes))
+	simple := headAnalysis.value != nil
+	for i, argNode := range argNodes {
+		args[i] = a.analyze(argNode)
+		simple = simple && args[i].pure
+	}
+
+	// evalArgs evaluates the arguments from the i-th on into values. The first
+	// time the continuation for an argument resumes, it fills in the rest of
+	// values in place. Any later time, which only happens with call/cc, it
+	// starts from a copy of the values before the argument, which no
+	// resumption changes.
+	var evalArgs func(th *thread, e Env, i int, values ast.Nodes, r Routine, k *continuation) packet
+	evalArgs = func(th *thread, e Env, i int, values ast.Nodes, r Routine, k *continuation) packet {
+		for ; i < len(args); i++ {
+			if args[i].value != nil {
+				if value, ok := args[i].value(th, e); ok {
+					values[i] = value
+					continue
+				}
+			}
+			argK := then(th, nil)
+			argK.fn = func(th *thread, value ast.Node) packet {
+				resumed := values
+				if !argK.firstResume() {
+					resumed = make(ast.Nodes, len(values))
+					copy(resumed, values[:i])
+				}
+				resumed[i] = value
+				return evalArgs(th, e, i+1, resumed, r, k)
+			}
+			return args[i].exec(th, e, argK)
+		}
+
+		th.form = l
+		if p, ok := r.(*Primitive); ok && p.Control == nil {
+			return resume(k, p.Value(th.interp, e, head, values))
+		}
+		return invokeRoutine(th, e, r, head, values, true, k)
+	}
+
+	apply := func(th *thread, e Env, evaluatedHead ast.Node, k *continuation) packet {
+		r, ok := evaluatedHead.(Routine)
+		if !ok {
+			panicEvalError(head, "First item in list not a routine: "+evaluatedHead.String())
+		}
+		if f, ok := r.(*Procedure); ok && f.IsMacro {
+			return evalMacroCall(th, e, f, l, k)
+		}
+		checkRoutineArgs(r, head, argNodes)
+		return evalArgs(th, e, 0, make(ast.Nodes, len(args)), r, k)
+	}
+
+	result := analysis{exec: func(th *thread, e Env, k *continuation) packet {
+		if evaluatedHead, ok := headAnalysis.valueNow(th, e); ok {
+			return apply(th, e, evaluatedHead, k)
+		}
+		return headAnalysis.exec(th, e, then(th, func(th *thread, evaluatedHead ast.Node) packet {
+			return apply(th, e, evaluatedHead, k)
+		}))
+	}}
+
+	if simple {
+		result.value = func(th *thread, e Env) (ast.Node, bool) {
+			evaluatedHead, ok := headAnalysis.value(th, e)
+			if !ok {
+				return nil, false
+			}
+			p, ok := evaluatedHead.(*Primitive)
+			if !ok || p.Control != nil {
+				return nil, false
+			}
+			checkPrimitiveArgs(p.Name, head, argNodes, p.MinArity, p.MaxArity)
+			values := make(ast.Nodes, len(args))
+			for i := range args {
+				if values[i], ok = args[i].value(th, e); !ok {
+					return nil, false
+				}
+			}
+			return p.Value(th.interp, e, head, values), true
+		}
+	}
+	return result
+}
+
+// valueNow computes the value of an analysed form without a continuation, if
+// it has one straight away. Otherwise the form must be run by exec. Callers
+// only create the continuation for exec when it is needed, since creating it
+// costs an allocation for every form run.
+func (an analysis) valueNow(th *thread, e Env) (ast.Node, bool) {
+	if an.value == nil {
+		return nil, false
+	}
+	return an.value(th, e)
+}
+
+// attach gives a procedure created by a proc form the parameter list and body
+// analysed for the form.
+func (ap *analyzedProcedure) attach(f *Procedure) {
+	f.parsedParameters.Store(ap.params)
+	f.analyzedBody.Store(ap.body)
+}
@@ -0,0 +1,48 @@
+package interpreter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+func analyzeString(t *testing.T, input string) analysis {
+	nodes, errs := parser.Parse(input, "analyze.v")
+	if errs.Len() != 0 {
+		t.Fatalf("Unexpected parse errors: %v", errs)
+	}
+	a := &analyzer{}
+	return a.analyze(nodes[0])
+}
+
+func TestAnalyze_PrimitiveCallsHaveValues(t *testing.T) {
+	for _, input := range []string{`(+ n 1)`, `(list 'a "b" 1)`, `(f)`} {
+		if analyzeString(t, input).value == nil {
+			t.Errorf("Expected <%v> to have a value", input)
+		}
+	}
+
+	// A call whose arguments are calls could fail after running one of them
+	for _, input := range []string{`(+ (f n) 1)`, `(f (+ n 1))`, `(if a b c)`} {
+		if analyzeString(t, input).value != nil {
+			t.Errorf("Expected <%v> not to have a value", input)
+		}
+	}
+}
+
+func TestAnalyze_ArgumentsRunOnce(t *testing.T) {
+	nodes, _ := parser.Parse(`(list (list (println 1) undefined-name))`, "analyze.v")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+	in.Engine = ClosureCompiler
+
+	_, err := in.Eval(nodes[0])
+	if err == nil {
+		t.Fatalf("Expected an error for the undefined name")
+	}
+	testhelp.CheckEqualString(t, "1\n", out.String())
+}
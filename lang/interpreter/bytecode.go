@@ -0,0 +1,399 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+////////// Bytecode
+
+// An opcode is an operation of the virtual machine. Most operations take and
+// leave values on the operand stack of the code being run.
+type opcode byte
+
+const (
+	opConst        opcode = iota // Push constant a
+	opNil                        // Push nil
+	opLoad                       // Push the value of the symbol in constant a, which is in none of the b frames out that the code knows of
+	opLoadLocal                  // Push the value of the symbol in constant a, which is in slot c of the frame b frames out
+	opPop                        // Discard the top of the stack
+	opJump                       // Continue at instruction a
+	opJumpIfFalse                // Pop a value, and continue at instruction a if it is false
+	opDef                        // Pop a value and define it under the name in the def form in constant a
+	opUpdate                     // Pop a value and update the name in the update! form in constant a
+	opProc                       // Push the procedure defined by the proc form in constant a, whose compiled body is procedure b
+	opCaseProc                   // Push the procedure defined by the case-proc form in constant a, whose compiled clauses start at procedure b
+	opEnterLet                   // Make a new frame for the variables of a let, with the slots of layout a
+	opLeaveLet                   // Return to the environment outside a let
+	opCheckPattern               // Check the let variable pattern in constant a
+	opBind                       // Pop a value and bind the let variable pattern in constant a to it
+	opCondFailed                 // Raise the error for the cond form in constant a having no matching clause
+	opPrepareCall                // Check the routine on the stack for the call in constant a, expanding a macro call and continuing at instruction b instead
+	opCall                       // Call the routine for the call in constant a with its arguments from the stack
+	opTailCall                   // Call the routine like opCall, returning its result
+	opEval                       // Push the value of constant a, as evaluated by the tree-walking evaluator
+	opTailEval                   // Return the value of constant a, as evaluated by the tree-walking evaluator
+	opReturn                     // Return the top of the stack
+)
+
+var opcodeNames = [...]string{
+	opConst:        "const",
+	opNil:          "nil",
+	opLoad:         "load",
+	opLoadLocal:    "load-local",
+	opPop:          "pop",
+	opJump:         "jump",
+	opJumpIfFalse:  "jump-if-false",
+	opDef:          "def",
+	opUpdate:       "update",
+	opProc:         "proc",
+	opCaseProc:     "case-proc",
+	opEnterLet:     "enter-let",
+	opLeaveLet:     "leave-let",
+	opCheckPattern: "check-pattern",
+	opBind:         "bind",
+	opCondFailed:   "cond-failed",
+	opPrepareCall:  "prepare-call",
+	opCall:         "call",
+	opTailCall:     "tail-call",
+	opEval:         "eval",
+	opTailEval:     "tail-eval",
+	opReturn:       "return",
+}
+
+type instruction struct {
+	op      opcode
+	a, b, c int
+}
+
+// code is a compiled form or procedure body. Its instructions refer to
+// values, symbols and whole forms by their index in the constants, to the
+// names of the slots of the frames they create by their index in the layouts,
+// and to the procedures defined within the code by their index in the
+// procedures.
+type code struct {
+	instructions []instruction
+	constants    []ast.Node
+	layouts      [][]*ast.Symbol
+	procedures   []*compiledProcedure
+	maxStack     int // The most values the code has on its operand stack at once
+}
+
+// A compiledProcedure is the parameter list and compiled body of a proc form,
+// which are shared by every procedure the form creates.
+type compiledProcedure struct {
+	params *parameterList
+	body   *code
+}
+
+// String disassembles the code, one instruction per line.
+func (c *code) String() string {
+	lines := make([]string, len(c.instructions))
+	for i, in := range c.instructions {
+		line := fmt.Sprintf("%3d %v", i, opcodeNames[in.op])
+		switch in.op {
+		case opJump, opJumpIfFalse:
+			line += fmt.Sprintf(" %v", in.a)
+		case opNil, opPop, opLeaveLet, opReturn:
+		case opEnterLet:
+			line += fmt.Sprintf(" %v", c.layouts[in.a])
+		case opLoadLocal:
+			line += fmt.Sprintf(" %v %v %v", c.constants[in.a], in.b, in.c)
+		case opPrepareCall, opProc, opCaseProc:
+			line += fmt.Sprintf(" %v %v", c.constants[in.a], in.b)
+		default:
+			line += fmt.Sprintf(" %v", c.constants[in.a])
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+////////// Compiler
+
+// compile translates a top-level form into code which returns its value.
+// Forms which the compiler does not translate itself, such as most special
+// forms and any form which is malformed, are left to the tree-walking
+// evaluator, so the code raises the same errors at the same points as the
+// evaluator would.
+func compile(n ast.Node) *code {
+	c := &compiler{code: &code{}}
+	c.compileNode(n, true)
+	return c.code
+}
+
+// compileBody translates the body of a procedure into code which runs in a
+// frame with a slot for each of its parameters. The scope is that of the code
+// the procedure is defined in, or nil if it is not known.
+func compileBody(params *parameterList, body ast.Node, parent *scope) *code {
+	c := &compiler{
+		code:  &code{},
+		scope: &scope{names: params.frameNames, parent: parent},
+	}
+	c.compileNode(body, true)
+	return c.code
+}
+
+type compiler struct {
+	code  *code
+	scope *scope
+	stack int // How many values the code emitted so far leaves on the operand stack
+}
+
+func (c *compiler) emit(op opcode, a int) int {
+	c.code.instructions = append(c.code.instructions, instruction{op: op, a: a})
+
+	// The operand stack is counted as if every instruction were run in turn.
+	// Code after a jump may really start with fewer values, so the most
+	// counted is never less than the most the code can have.
+	switch op {
+	case opConst, opNil, opLoad, opLoadLocal, opProc, opCaseProc, opEval:
+		c.stack++
+	case opPop, opJumpIfFalse, opBind, opReturn:
+		c.stack--
+	case opCall:
+		c.stack -= len(c.code.constants[a].(*ast.List).Nodes) - 1
+	case opTailCall:
+		c.stack -= len(c.code.constants[a].(*ast.List).Nodes)
+	}
+	c.code.maxStack = max(c.code.maxStack, c.stack)
+
+	return len(c.code.instructions) - 1
+}
+
+func (c *compiler) constant(n ast.Node) int {
+	c.code.constants = append(c.code.constants, n)
+	return len(c.code.constants) - 1
+}
+
+// here is the index of the next instruction to be emitted.
+func (c *compiler) here() int {
+	return len(c.code.instructions)
+}
+
+// patch makes the jump at instruction i go to the next instruction.
+func (c *compiler) patch(i int) {
+	c.code.instructions[i].a = c.here()
+}
+
+// finish returns the value on the top of the stack if the form just compiled
+// is in tail position.
+func (c *compiler) finish(tail bool) {
+	if tail {
+		c.emit(opReturn, 0)
+	}
+}
+
+// compileNode compiles a form. A form in tail position returns its value
+// rather than leaving it on the stack.
+func (c *compiler) compileNode(n ast.Node, tail bool) {
+	switch value := n.(type) {
+	case *ast.Number, *ast.Str, *ast.Char:
+		c.emit(opConst, c.constant(value))
+		c.finish(tail)
+	case *ast.Nil:
+		c.emit(opNil, 0)
+		c.finish(tail)
+	case *ast.Symbol:
+		if depth, slot, ok := c.scope.resolve(value); ok {
+			i := c.emit(opLoadLocal, c.constant(value))
+			c.code.instructions[i].b, c.code.instructions[i].c = depth, slot
+		} else {
+			i := c.emit(opLoad, c.constant(value))
+			c.code.instructions[i].b = c.scope.depth()
+		}
+		c.finish(tail)
+	case *ast.List:
+		c.compileList(value, tail)
+	default:
+		c.compileEval(n, tail)
+	}
+}
+
+// compileEval leaves a form to the tree-walking evaluator.
+func (c *compiler) compileEval(n ast.Node, tail bool) {
+	if tail {
+		c.emit(opTailEval, c.constant(n))
+	} else {
+		c.emit(opEval, c.constant(n))
+	}
+}
+
+func (c *compiler) compileList(l *ast.List, tail bool) {
+	if len(l.Nodes) == 0 {
+		c.compileEval(l, tail)
+		return
+	}
+
+	head := l.Nodes[0]
+	args := l.Nodes[1:]
+
+	symbol, ok := head.(*ast.Symbol)
+	if !ok || !isSpecialForm(symbol.Base().Name) {
+		c.compileCall(l, tail)
+		return
+	}
+
+	switch name := symbol.Base().Name; {
+	case name == "quote" && len(args) == 1:
+		c.emit(opConst, c.constant(stripAliases(args[0])))
+		c.finish(tail)
+	case name == "if" && len(args) == 3:
+		c.compileIf(args, tail)
+	case name == "cond" && len(args) >= 2 && len(args)%2 == 0:
+		c.compileCond(l, tail)
+	case name == "begin":
+		c.compileSequence(args, tail)
+	case name == "let" && len(args) == 2 && isBindingList(args[0]):
+		c.compileLet(args, tail)
+	case name == "def" && len(args) == 2 && isSymbol(args[0]):
+		c.compileNode(args[1], false)
+		c.emit(opDef, c.constant(l))
+		c.finish(tail)
+	case name == "update!" && len(args) == 2 && isSymbol(args[0]):
+		c.compileNode(args[1], false)
+		c.emit(opUpdate, c.constant(l))
+		c.finish(tail)
+	case name == "proc" && len(args) == 2:
+		i := c.emit(opProc, c.constant(l))
+		c.code.instructions[i].b = c.compileProcedures(ast.Nodes{ast.NewList(args)})
+		c.finish(tail)
+	case name == "case-proc" && len(args) >= 1:
+		i := c.emit(opCaseProc, c.constant(l))
+		c.code.instructions[i].b = c.compileProcedures(args)
+		c.finish(tail)
+	default:
+		c.compileEval(l, tail)
+	}
+}
+
+func (c *compiler) compileIf(args []ast.Node, tail bool) {
+	c.compileNode(args[0], false)
+	toElse := c.emit(opJumpIfFalse, 0)
+	c.compileNode(args[1], tail)
+
+	toEnd := -1
+	if !tail {
+		toEnd = c.emit(opJump, 0)
+	}
+	c.patch(toElse)
+	c.compileNode(args[2], tail)
+
+	if toEnd >= 0 {
+		c.patch(toEnd)
+	}
+}
+
+func (c *compiler) compileCond(l *ast.List, tail bool) {
+	args := l.Nodes[1:]
+
+	var toEnd []int
+	for i := 0; i < len(args); i += 2 {
+		c.compileNode(args[i], false)
+		toNext := c.emit(opJumpIfFalse, 0)
+		c.compileNode(args[i+1], tail)
+		if !tail {
+			toEnd = append(toEnd, c.emit(opJump, 0))
+		}
+		c.patch(toNext)
+	}
+	c.emit(opCondFailed, c.constant(l))
+
+	for _, i := range toEnd {
+		c.patch(i)
+	}
+}
+
+func (c *compiler) compileSequence(ns []ast.Node, tail bool) {
+	if len(ns) == 0 {
+		c.emit(opNil, 0)
+		c.finish(tail)
+		return
+	}
+
+	for _, n := range ns[:len(ns)-1] {
+		c.compileNode(n, false)
+		c.emit(opPop, 0)
+	}
+	c.compileNode(ns[len(ns)-1], tail)
+}
+
+func (c *compiler) compileLet(args []ast.Node, tail bool) {
+	variableNodes := args[0].(*ast.List).Nodes
+
+	var names []*ast.Symbol
+	for i := 0; i < len(variableNodes); i += 2 {
+		names = patternNames(variableNodes[i], names)
+	}
+	c.code.layouts = append(c.code.layouts, names)
+	c.emit(opEnterLet, len(c.code.layouts)-1)
+
+	// The values are evaluated in the frame of the let, so that each may refer
+	// to the variables before it
+	outer := c.scope
+	c.scope = &scope{names: names, parent: outer}
+	defer func() { c.scope = outer }()
+
+	for i := 0; i < len(variableNodes); i += 2 {
+		pattern := c.constant(variableNodes[i])
+		if !isSymbol(variableNodes[i]) {
+			c.emit(opCheckPattern, pattern)
+		}
+		c.compileNode(variableNodes[i+1], false)
+		c.emit(opBind, pattern)
+	}
+
+	c.compileNode(args[1], tail)
+	if !tail {
+		c.emit(opLeaveLet, 0)
+	}
+}
+
+// compileProcedures compiles the bodies of procedures defined by clauses of
+// the form (params body) within the code, returning the index of the first
+// one. If any of the clauses is malformed, none is compiled and -1 is
+// returned, leaving the error to be raised when the procedure is created or
+// called.
+func (c *compiler) compileProcedures(clauses []ast.Node) int {
+	compiled := make([]*compiledProcedure, len(clauses))
+	for i, clause := range clauses {
+		l, ok := clause.(*ast.List)
+		if !ok || len(l.Nodes) != 2 {
+			return -1
+		}
+		paramNodes, ok := l.Nodes[0].(ast.Coll)
+		if !ok {
+			return -1
+		}
+		params, ok := tryParseParameters(paramNodes.Children())
+		if !ok {
+			return -1
+		}
+		compiled[i] = &compiledProcedure{params: params, body: compileBody(params, l.Nodes[1], c.scope)}
+	}
+
+	c.code.procedures = append(c.code.procedures, compiled...)
+	return len(c.code.procedures) - len(compiled)
+}
+
+// compileCall compiles a call of a routine, or of a macro, which can only be
+// told apart once the head has been evaluated.
+func (c *compiler) compileCall(l *ast.List, tail bool) {
+	form := c.constant(l)
+
+	c.compileNode(l.Nodes[0], false)
+	prepare := c.emit(opPrepareCall, form)
+	for _, arg := range l.Nodes[1:] {
+		c.compileNode(arg, false)
+	}
+
+	if tail {
+		c.emit(opTailCall, form)
+		c.code.instructions[prepare].b = -1
+	} else {
+		c.emit(opCall, form)
+		c.code.instructions[prepare].b = c.here()
+	}
+}
@@ -0,0 +1,64 @@
+package interpreter
+
+import (
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+func compileString(t *testing.T, input string) *code {
+	nodes, errs := parser.Parse(input, "bytecode.v")
+	if errs.Len() != 0 {
+		t.Fatalf("Unexpected parse errors: %v", errs)
+	}
+	return compile(nodes[0])
+}
+
+func TestCompile_TailCall(t *testing.T) {
+	c := compileString(t, `(if (> n 1) (f (- n 1)) n)`)
+	testhelp.CheckEqualString(t, `  0 load >
+  1 prepare-call (> n 1) 5
+  2 load n
+  3 const 1
+  4 call (> n 1)
+  5 jump-if-false 14
+  6 load f
+  7 prepare-call (f (- n 1)) -1
+  8 load -
+  9 prepare-call (- n 1) 13
+ 10 load n
+ 11 const 1
+ 12 call (- n 1)
+ 13 tail-call (f (- n 1))
+ 14 load n
+ 15 return`, c.String())
+}
+
+func TestCompile_SpecialFormsLeftToEvaluator(t *testing.T) {
+	c := compileString(t, `(begin (try (f) (catch e 1)) (let (x) x))`)
+	testhelp.CheckEqualString(t, `  0 eval (try (f) (catch e 1))
+  1 pop
+  2 tail-eval (let (x) x)`, c.String())
+}
+
+func TestCompile_LexicalAddressing(t *testing.T) {
+	c := compileString(t, `(proc (a b) (let (c a) (proc (d) (list a c d))))`)
+	testhelp.CheckEqualString(t, `  0 proc (proc (a b) (let (c a) (proc (d) (list a c d)))) 0
+  1 return`, c.String())
+
+	outer := c.procedures[0].body
+	testhelp.CheckEqualString(t, `  0 enter-let [c]
+  1 load-local a 1 0
+  2 bind c
+  3 proc (proc (d) (list a c d)) 0
+  4 return`, outer.String())
+
+	inner := outer.procedures[0].body
+	testhelp.CheckEqualString(t, `  0 load list
+  1 prepare-call (list a c d) -1
+  2 load-local a 2 0
+  3 load-local c 1 0
+  4 load-local d 0 0
+  5 tail-call (list a c d)`, inner.String())
+}
@@ -12,6 +12,26 @@ func toListValue(n ast.Node) *ast.List {
 	return nil
 }
 
+func toCollValue(n ast.Node) ast.Coll {
+	switch value := n.(type) {
+	case ast.Coll:
+		return value
+	}
+
+	panicEvalError(n, "Expression is not a collection: "+n.String())
+	return nil
+}
+
+func toRoutineValue(n ast.Node) Routine {
+	switch value := n.(type) {
+	case Routine:
+		return value
+	}
+
+	panicEvalError(n, "Expression is not a routine: "+n.String())
+	return nil
+}
+
 func toNumberValue(n ast.Node) float64 {
 	switch value := n.(type) {
 	case *ast.Number:
@@ -32,11 +52,43 @@ func toSymbolValue(n ast.Node) string {
 	return ""
 }
 
+func toErrorValue(n ast.Node) *EvalError {
+	switch value := n.(type) {
+	case *ErrorNode:
+		return value.Err
+	}
+
+	panicEvalError(n, "Expression is not an error: "+n.String())
+	return nil
+}
+
+func toGoValue(n ast.Node) *GoValue {
+	switch value := n.(type) {
+	case *GoValue:
+		return value
+	}
+
+	panicEvalError(n, "Expression is not a Go value: "+n.String())
+	return nil
+}
+
+// toNameValue returns the name given by a symbol or a string.
+func toNameValue(n ast.Node) string {
+	switch value := n.(type) {
+	case *ast.Symbol:
+		return value.Name
+	case *ast.Str:
+		return value.Value
+	}
+
+	panicEvalError(n, "Expression is not a symbol or a string: "+n.String())
+	return ""
+}
+
 func toBooleanValue(n ast.Node) bool {
 	switch value := n.(type) {
 	case *ast.Symbol:
-		switch value.Name {
-		case "false":
+		if value.Interned() == falseSymbol {
 			return false
 		}
 	case *ast.Nil:
@@ -0,0 +1,88 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+////////// Destructuring
+
+// bindPattern binds the names in a parameter pattern to the corresponding
+// parts of a value. A pattern is either a symbol, which is bound to the whole
+// value, or a list of patterns, which is matched element by element against a
+// collection of the same shape. A list pattern may end with '&rest name' to
+// bind the remaining elements as a list.
+func bindPattern(e Env, pattern ast.Node, value ast.Node) {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		e.Set(p, value)
+	case *ast.List:
+		coll, ok := value.(ast.Coll)
+		if !ok {
+			panicEvalError(pattern, fmt.Sprintf(
+				"Cannot destructure %v with pattern %v: not a collection", value, pattern))
+		}
+		bindPatterns(e, p, p.Nodes, coll.Children(), value)
+	default:
+		panicEvalError(pattern, "Invalid parameter pattern: "+pattern.String())
+	}
+}
+
+// bindPatterns binds a list of patterns to a list of values. The pattern and
+// value the lists came from are used to describe a mismatch in their shapes.
+func bindPatterns(e Env, pattern ast.Node, patterns []ast.Node, values []ast.Node, value ast.Node) {
+	minCount, maxCount := patternArity(patterns)
+	if len(values) < minCount || (maxCount != -1 && len(values) > maxCount) {
+		panicEvalError(pattern, fmt.Sprintf(
+			"Cannot destructure %v with pattern %v: expected %v element(s), but got %v",
+			value,
+			pattern,
+			describeArity(minCount, maxCount),
+			len(values)))
+	}
+
+	for i, p := range patterns {
+		if isKeyword(p, "&rest") {
+			bindPattern(e, patterns[i+1], ast.NewList(values[i:]))
+			return
+		}
+		bindPattern(e, p, values[i])
+	}
+}
+
+// patternArity returns the minimum and maximum number of values a list of
+// patterns accepts. The maximum is -1 if there is no limit.
+func patternArity(patterns []ast.Node) (int, int) {
+	for i, p := range patterns {
+		if isKeyword(p, "&rest") {
+			return i, -1
+		}
+	}
+	return len(patterns), len(patterns)
+}
+
+// checkPattern panics if a pattern is malformed. The kind describes what the
+// pattern is for, such as "Procedure parameters".
+func checkPattern(kind string, head ast.Node, pattern ast.Node) {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		return
+	case *ast.List:
+		checkPatterns(kind, head, p.Nodes)
+	default:
+		panicEvalError(head, kind+" should only be symbols or lists: "+pattern.String())
+	}
+}
+
+func checkPatterns(kind string, head ast.Node, patterns []ast.Node) {
+	for i, p := range patterns {
+		if isKeyword(p, "&rest") && i != len(patterns)-2 {
+			panicEvalError(head, "'&rest' should be followed by exactly one parameter: "+ast.NewList(patterns).String())
+		}
+		if isKeyword(p, "&optional") || isKeyword(p, "&key") {
+			panicEvalError(head, "'"+p.String()+"' can only be used in the parameters of a procedure, not in a pattern: "+ast.NewList(patterns).String())
+		}
+		checkPattern(kind, head, p)
+	}
+}
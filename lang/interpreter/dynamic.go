@@ -0,0 +1,122 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Dynamic Variables
+
+// A dynamicBinding gives a dynamic variable a value for the dynamic extent of
+// a 'binding' form. The bindings of a thread form a chain, innermost first,
+// which is part of its dynamic state, so they are undone when the form exits
+// normally, when an error unwinds out of it, and when a continuation captured
+// outside of it is resumed.
+type dynamicBinding struct {
+	variable *DynamicVar
+	value    ast.Node
+	parent   *dynamicBinding
+}
+
+// findBinding returns the innermost binding of a dynamic variable in the
+// thread, or nil if it has none.
+func findBinding(th *thread, dv *DynamicVar) *dynamicBinding {
+	for b := th.bindings; b != nil; b = b.parent {
+		if b.variable == dv {
+			return b
+		}
+	}
+	return nil
+}
+
+// dynamicValue returns the value of a dynamic variable in the thread, which is
+// its innermost binding or else its root value.
+func dynamicValue(th *thread, dv *DynamicVar) ast.Node {
+	if b := findBinding(th, dv); b != nil {
+		return b.value
+	}
+	return dv.Root
+}
+
+// updateDynamicValue changes the innermost binding of a dynamic variable in
+// the thread, or its root value if it has no binding.
+func updateDynamicValue(th *thread, dv *DynamicVar, value ast.Node) {
+	if b := findBinding(th, dv); b != nil {
+		b.value = value
+		return
+	}
+	dv.Root = value
+}
+
+// copyBindings copies a chain of bindings, so that a thread started with 'go'
+// sees the bindings of its parent, but neither sees the other update them.
+func copyBindings(b *dynamicBinding) *dynamicBinding {
+	if b == nil {
+		return nil
+	}
+	return &dynamicBinding{
+		variable: b.variable,
+		value:    b.value,
+		parent:   copyBindings(b.parent),
+	}
+}
+
+// specialDefdynamic defines a dynamic variable with a root value, which is its
+// value wherever it has not been rebound by 'binding'.
+func specialDefdynamic(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	name := toSymbol(args[0])
+
+	return evalNode(th, e, args[1], then(th, func(th *thread, root ast.Node) packet {
+		if _, exists := e.Get(name); exists {
+			panicEvalError(head, "Cannot redefine a name: "+name.Name)
+		}
+		e.Set(name, &DynamicVar{Name: name.Name, Root: root})
+		return resume(k, &ast.Nil{})
+	}))
+}
+
+// specialBinding evaluates its body forms with dynamic variables rebound, as
+// in (binding (name1 value1 name2 value2 ...) forms...). The values are all
+// evaluated before any of the variables are rebound.
+func specialBinding(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	bindingList, ok := args[0].(*ast.List)
+	if !ok || len(bindingList.Nodes)%2 != 0 {
+		panicEvalError(head, "Expected a list of dynamic variables and values as first argument to 'binding': "+args[0].String())
+	}
+
+	var variables []*DynamicVar
+	var expressions []ast.Node
+	for i := 0; i < len(bindingList.Nodes); i += 2 {
+		variables = append(variables, toDynamicVar(e, bindingList.Nodes[i]))
+		expressions = append(expressions, bindingList.Nodes[i+1])
+	}
+
+	outerState := th.dynamicState
+
+	return evalEachNode(th, e, expressions, func(th *thread, values []ast.Node) packet {
+		for i, dv := range variables {
+			th.bindings = &dynamicBinding{
+				variable: dv,
+				value:    values[i],
+				parent:   th.bindings,
+			}
+		}
+
+		return evalSequence(th, e, args[1:], then(th, func(th *thread, result ast.Node) packet {
+			th.dynamicState = outerState
+			return resume(k, result)
+		}))
+	})
+}
+
+// toDynamicVar returns the dynamic variable a name in a 'binding' form refers
+// to, panicking if it does not refer to one.
+func toDynamicVar(e Env, n ast.Node) *DynamicVar {
+	if symbol, ok := n.(*ast.Symbol); ok {
+		if value, ok := lookupSymbol(e, symbol); ok {
+			if dv, ok := value.(*DynamicVar); ok {
+				return dv
+			}
+		}
+	}
+
+	panicEvalError(n, "Not a dynamic variable: "+n.String())
+	return nil
+}
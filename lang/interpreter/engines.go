@@ -0,0 +1,77 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Engines
+
+// Engine is a way of evaluating Vamos code.
+type Engine int
+
+const (
+	// TreeWalker evaluates forms by walking their syntax trees, looking each
+	// variable up by name. The other engines leave the forms they do not
+	// translate to it.
+	TreeWalker Engine = iota
+	// BytecodeVM compiles top-level forms and procedure bodies to bytecode,
+	// which is run by a stack-based virtual machine.
+	BytecodeVM
+	// ClosureCompiler analyses top-level forms and procedure bodies once into
+	// trees of Go closures, which are run without looking at the forms again.
+	ClosureCompiler
+)
+
+// evalTopLevel evaluates a top-level form with the engine of the interpreter.
+func evalTopLevel(th *thread, e Env, n ast.Node, k *continuation) packet {
+	th.form, _ = n.(*ast.List)
+	return prepare(th.interp.Engine, n).exec(th, e, k)
+}
+
+// A preparedForm is a form made ready to be run by an engine, any number of
+// times and in any environment.
+type preparedForm struct {
+	engine Engine
+	exec   executor
+}
+
+// prepare makes a form ready to be run by an engine: compiled to bytecode for
+// the virtual machine, analysed for the closure compiler, or as it is for the
+// tree walker.
+func prepare(engine Engine, n ast.Node) *preparedForm {
+	switch engine {
+	case BytecodeVM:
+		c := compile(n)
+		return &preparedForm{engine: engine, exec: func(th *thread, e Env, k *continuation) packet {
+			return execute(th, c, k, 0, e, newOperandStack(c))
+		}}
+	case ClosureCompiler:
+		return &preparedForm{engine: engine, exec: analyzeTopLevel(n)}
+	}
+	return &preparedForm{engine: engine, exec: func(th *thread, e Env, k *continuation) packet {
+		return evalNode(th, e, n, k)
+	}}
+}
+
+// newProcedureEnv creates the environment for a call of a procedure. For the
+// virtual machine and the closure compiler, which resolve references to
+// parameters before the code runs, it is a frame with a slot for each of the
+// parameters.
+func newProcedureEnv(th *thread, f *Procedure, params *parameterList, parent Env) Env {
+	if th.interp.Engine == TreeWalker {
+		return NewMapEnv(f.Name, parent)
+	}
+	return NewFrameEnv(f.Name, params.frameNames, parent)
+}
+
+// evalBody evaluates the body of a procedure with the engine of the
+// interpreter.
+func evalBody(th *thread, e Env, f *Procedure, k *continuation) packet {
+	th.form, _ = f.Body.(*ast.List)
+	switch th.interp.Engine {
+	case BytecodeVM:
+		c := f.bytecode()
+		return execute(th, c, k, 0, e, newOperandStack(c))
+	case ClosureCompiler:
+		return f.analysis().exec(th, e, k)
+	}
+	return evalNode(th, e, f.Body, k)
+}
@@ -10,11 +10,13 @@ import (
 
 // Env represents an environment.
 // An environment (AKA a scope) contains symbols that are in scope and which
-// environment, if any, is the parent of this environment.
+// environment, if any, is the parent of this environment. Variables are keyed
+// by the interned symbol, so a symbol is found by comparing pointers rather
+// than names.
 type Env interface {
-	Set(name string, value ast.Node)
-	Update(name string, value ast.Node) bool
-	Get(name string) (ast.Node, bool)
+	Set(name *ast.Symbol, value ast.Node)
+	Update(name *ast.Symbol, value ast.Node) bool
+	Get(name *ast.Symbol) (ast.Node, bool)
 	String() string
 	Parent() Env
 	Name() string
@@ -25,7 +27,7 @@ type Env interface {
 // MapEnv is an implementation of an environment using a hash map.
 type MapEnv struct {
 	name    string
-	symbols map[string]ast.Node
+	symbols map[*ast.Symbol]ast.Node
 	parent  Env
 }
 
@@ -34,7 +36,7 @@ type MapEnv struct {
 func NewTopLevelMapEnv() *MapEnv {
 	e := &MapEnv{
 		name:    "TopLevel",
-		symbols: make(map[string]ast.Node),
+		symbols: make(map[*ast.Symbol]ast.Node),
 		parent:  nil,
 	}
 
@@ -47,22 +49,24 @@ func NewTopLevelMapEnv() *MapEnv {
 func NewMapEnv(name string, parent Env) *MapEnv {
 	return &MapEnv{
 		name:    name,
-		symbols: make(map[string]ast.Node),
+		symbols: make(map[*ast.Symbol]ast.Node),
 		parent:  parent,
 	}
 }
 
 // Set sets the initial value of a symbol.
-func (e *MapEnv) Set(name string, value ast.Node) {
+func (e *MapEnv) Set(name *ast.Symbol, value ast.Node) {
+	name = name.Interned()
 	if _, exists := e.symbols[name]; exists {
-		panicEvalError(value, "Cannot set the initial value of a symbol again: "+name)
+		panicEvalError(value, "Cannot set the initial value of a symbol again: "+name.Name)
 	} else {
 		e.symbols[name] = value
 	}
 }
 
 // Update updates the value of an existing symbol.
-func (e *MapEnv) Update(name string, value ast.Node) bool {
+func (e *MapEnv) Update(name *ast.Symbol, value ast.Node) bool {
+	name = name.Interned()
 	_, exists := e.symbols[name]
 
 	if !exists {
@@ -77,8 +81,8 @@ func (e *MapEnv) Update(name string, value ast.Node) bool {
 }
 
 // Get returns the value of a symbol.
-func (e *MapEnv) Get(name string) (ast.Node, bool) {
-	value, exists := e.symbols[name]
+func (e *MapEnv) Get(name *ast.Symbol) (ast.Node, bool) {
+	value, exists := e.symbols[name.Interned()]
 
 	if !exists {
 		if e.Parent() == nil {
@@ -97,10 +101,175 @@ func (e *MapEnv) Parent() Env {
 
 // String returns a string representation of the environment.
 func (e *MapEnv) String() string {
-	return fmt.Sprintf("%v:%v", e.name, e.symbols)
+	return fmt.Sprintf("%v:%v", e.name, symbolsByName(e.symbols))
+}
+
+// symbolsByName returns the variables of an environment keyed by their names,
+// so that they are listed in order of name.
+func symbolsByName(symbols map[*ast.Symbol]ast.Node) map[string]ast.Node {
+	byName := make(map[string]ast.Node, len(symbols))
+	for symbol, value := range symbols {
+		byName[symbol.Name] = value
+	}
+	return byName
 }
 
 // Name returns the name of the environment.
 func (e *MapEnv) Name() string {
 	return e.name
 }
+
+////////// FrameEnv
+
+// FrameEnv is an environment whose variables are known in advance, such as
+// the parameters of a procedure, and are kept in an array. Compiled code finds
+// a variable by its position, counting frames out from the innermost and then
+// slots within the frame, rather than by looking its name up in each
+// environment in turn. Names defined which are not among the known variables,
+// such as by 'def' in the body of a procedure, are kept in a map.
+type FrameEnv struct {
+	name   string
+	names  []*ast.Symbol // The names of the slots, which are shared by every frame for the same code
+	values []ast.Node    // The value of each slot, or nil if it has not been set yet
+	extra  map[*ast.Symbol]ast.Node
+	parent Env
+}
+
+// smallFrameSize is the most slots a frame may have to be allocated along
+// with its slots, which most procedure calls and let forms fit within.
+const smallFrameSize = 3
+
+// smallFrameEnv is a frame and its slots, allocated together.
+type smallFrameEnv struct {
+	FrameEnv
+	slots [smallFrameSize]ast.Node
+}
+
+// NewFrameEnv creates an environment with a slot for each of the names.
+func NewFrameEnv(name string, names []*ast.Symbol, parent Env) *FrameEnv {
+	if len(names) <= smallFrameSize {
+		f := &smallFrameEnv{FrameEnv: FrameEnv{name: name, names: names, parent: parent}}
+		f.values = f.slots[:len(names)]
+		return &f.FrameEnv
+	}
+
+	return &FrameEnv{
+		name:   name,
+		names:  names,
+		values: make([]ast.Node, len(names)),
+		parent: parent,
+	}
+}
+
+// slot returns the position of the slot for a name, or -1 if there is none.
+func (e *FrameEnv) slot(name *ast.Symbol) int {
+	for i, n := range e.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Set sets the initial value of a symbol.
+func (e *FrameEnv) Set(name *ast.Symbol, value ast.Node) {
+	name = name.Interned()
+	if i := e.slot(name); i >= 0 && e.values[i] == nil {
+		e.values[i] = value
+		return
+	}
+
+	if _, exists := e.extra[name]; exists || e.slot(name) >= 0 {
+		panicEvalError(value, "Cannot set the initial value of a symbol again: "+name.Name)
+	}
+	if e.extra == nil {
+		e.extra = make(map[*ast.Symbol]ast.Node)
+	}
+	e.extra[name] = value
+}
+
+// Update updates the value of an existing symbol.
+func (e *FrameEnv) Update(name *ast.Symbol, value ast.Node) bool {
+	name = name.Interned()
+	if i := e.slot(name); i >= 0 && e.values[i] != nil {
+		e.values[i] = value
+		return true
+	}
+	if _, exists := e.extra[name]; exists {
+		e.extra[name] = value
+		return true
+	}
+
+	if e.parent == nil {
+		return false
+	}
+	return e.parent.Update(name, value)
+}
+
+// Get returns the value of a symbol.
+func (e *FrameEnv) Get(name *ast.Symbol) (ast.Node, bool) {
+	name = name.Interned()
+	if i := e.slot(name); i >= 0 && e.values[i] != nil {
+		return e.values[i], true
+	}
+	if value, exists := e.extra[name]; exists {
+		return value, true
+	}
+
+	if e.parent == nil {
+		return nil, false
+	}
+	return e.parent.Get(name)
+}
+
+// Parent returns the parent environment.
+func (e *FrameEnv) Parent() Env {
+	return e.parent
+}
+
+// String returns a string representation of the environment.
+func (e *FrameEnv) String() string {
+	symbols := symbolsByName(e.extra)
+	for i, name := range e.names {
+		if e.values[i] != nil {
+			symbols[name.Name] = e.values[i]
+		}
+	}
+	return fmt.Sprintf("%v:%v", e.name, symbols)
+}
+
+// Name returns the name of the environment.
+func (e *FrameEnv) Name() string {
+	return e.name
+}
+
+////////// Symbol Lookup
+
+// lookupSymbol returns the value a symbol refers to in the environment. A
+// symbol renamed by a hygienic macro which the expansion has not bound refers
+// to the symbol it stands for in the environment the macro was defined in.
+func lookupSymbol(e Env, s *ast.Symbol) (ast.Node, bool) {
+	for {
+		if value, ok := e.Get(s); ok {
+			return value, true
+		}
+		if s.Alias == nil {
+			return nil, false
+		}
+		e, s = s.Alias.Scope.(Env), s.Alias.Original
+	}
+}
+
+// updateSymbol updates the value of the name a symbol refers to, following the
+// same rules as lookupSymbol.
+func updateSymbol(e Env, s *ast.Symbol, value ast.Node) bool {
+	for {
+		if e.Update(s, value) {
+			return true
+		}
+		if s.Alias == nil {
+			return false
+		}
+		e, s = s.Alias.Scope.(Env), s.Alias.Original
+	}
+}
@@ -1,18 +1,44 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
-	"io"
 
 	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/token"
 )
 
-// TODO get rid of this global variable
-var writer io.Writer
-var readLine func() string
+// run trampolines a computation in a new thread of the interpreter, returning
+// its result or the evaluation error which escaped it.
+func (in *Interpreter) run(start func(*thread) packet) (result ast.Node, err error) {
+	return in.runWithin(nil, start)
+}
+
+// runLimited is like run, but stops the computation with an InterruptError when
+// the context is done or a limit on steps or time is exceeded, and raises an
+// evaluation error when the limit on depth is exceeded.
+func (in *Interpreter) runLimited(ctx context.Context, limits Limits, start func(*thread) packet) (result ast.Node, err error) {
+	if !limits.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, limits.Deadline)
+		defer cancel()
+	}
+
+	l := &evalLimits{maxDepth: DefaultMaxDepth}
+	if ctx.Done() != nil || limits.MaxSteps > 0 {
+		l.limiter = &limiter{ctx: ctx, maxSteps: int64(limits.MaxSteps)}
+	}
+	if limits.MaxDepth != 0 {
+		l.maxDepth = limits.MaxDepth
+	}
+	defer l.finished.Store(true)
+
+	return in.runWithin(l, start)
+}
 
-// Eval evaluates a node in an environment.
-func Eval(e Env, n ast.Node, w io.Writer, rl func() string) (result ast.Node, err error) {
+// runWithin trampolines a computation in a new thread subject to the limits of
+// an evaluation, if any.
+func (in *Interpreter) runWithin(limits *evalLimits, start func(*thread) packet) (result ast.Node, err error) {
 	defer func() {
 		if e := recover(); e != nil {
 			result = nil
@@ -20,60 +46,145 @@ func Eval(e Env, n ast.Node, w io.Writer, rl func() string) (result ast.Node, er
 			case *EvalError:
 				err = errorValue
 				return
+			case *InterruptError:
+				err = errorValue
+				return
 			default:
 				panic(errorValue)
 			}
 		}
 	}()
 
-	writer = w
-	readLine = rl
-
+	th := newThread(in)
+	if limits != nil {
+		limits.apply(th)
+	}
 	startThunk := func() packet {
-		return evalNode(e, n)
+		return start(th)
 	}
 
-	return trampoline(startThunk), nil
+	return trampoline(th, startThunk), nil
+}
+
+// evalEachNode evaluates the nodes from left to right and passes the list of
+// results to k.
+func evalEachNode(th *thread, e Env, ns []ast.Node, k func(*thread, []ast.Node) packet) packet {
+	return evalEachNodeFrom(th, e, ns, make([]ast.Node, 0, len(ns)), k)
+}
+
+func evalEachNodeFrom(th *thread, e Env, ns []ast.Node, evaluated []ast.Node, k func(*thread, []ast.Node) packet) packet {
+	for len(evaluated) < len(ns) {
+		n := ns[len(evaluated)]
+		if value, ok := evalSimple(th, e, n); ok {
+			evaluated = append(evaluated, value)
+			continue
+		}
+
+		return evalNode(th, e, n, then(th, func(th *thread, result ast.Node) packet {
+			// A continuation may be resumed more than once, so the results gathered
+			// so far are copied rather than appended to in place
+			next := make([]ast.Node, len(evaluated), len(ns))
+			copy(next, evaluated)
+			return evalEachNodeFrom(th, e, ns, append(next, result), k)
+		}))
+	}
+
+	return k(th, evaluated)
+}
+
+// evalSimple returns the value of a node which can be evaluated without a
+// continuation: a constant, a defined name, or a call of a primitive whose
+// arguments are constants or defined names. It reports false for any other
+// node, which must be evaluated with evalNode. Most nodes are simple, and
+// evaluating them directly saves allocating a continuation for each one.
+func evalSimple(th *thread, e Env, n ast.Node) (ast.Node, bool) {
+	l, ok := n.(*ast.List)
+	if !ok {
+		return evalAtom(th, e, n)
+	}
+
+	if len(l.Nodes) == 0 {
+		return nil, false
+	}
+	head, ok := l.Nodes[0].(*ast.Symbol)
+	if !ok || isSpecialForm(head.Base().Name) {
+		return nil, false
+	}
+	value, ok := evalAtom(th, e, head)
+	if !ok {
+		return nil, false
+	}
+	p, ok := value.(*Primitive)
+	if !ok || p.Control != nil {
+		return nil, false
+	}
+
+	unevaledArgs := l.Nodes[1:]
+	checkPrimitiveArgs(p.Name, head, unevaledArgs, p.MinArity, p.MaxArity)
+	args := make([]ast.Node, len(unevaledArgs))
+	for i, arg := range unevaledArgs {
+		if _, isList := arg.(*ast.List); isList {
+			return nil, false
+		}
+		if args[i], ok = evalAtom(th, e, arg); !ok {
+			return nil, false
+		}
+	}
+	return p.Value(th.interp, e, head, args), true
 }
 
-func evalEachNode(e Env, ns []ast.Node) []ast.Node {
-	result := make([]ast.Node, len(ns))
-	for i, n := range ns {
-		evalNodeThunk := func() packet {
-			return evalNode(e, n)
+// evalAtom returns the value of a node which is not a list, reporting false
+// if it is a list or a name which is not defined.
+func evalAtom(th *thread, e Env, n ast.Node) (ast.Node, bool) {
+	switch value := n.(type) {
+	case *ast.Number, *ast.Str, *ast.Char:
+		return value, true
+	case *ast.Nil:
+		return &ast.Nil{}, true
+	case *ast.Symbol:
+		result, ok := lookupSymbol(e, value)
+		if !ok {
+			return nil, false
+		}
+		if dv, ok := result.(*DynamicVar); ok {
+			return dynamicValue(th, dv), true
 		}
-		result[i] = trampoline(evalNodeThunk)
+		return result, true
 	}
-	return result
+	return nil, false
 }
 
-func evalNode(e Env, n ast.Node) packet {
+func evalNode(th *thread, e Env, n ast.Node, k *continuation) packet {
 
 	switch value := n.(type) {
 	case *ast.Number:
-		return respond(value)
+		return resume(k, value)
 	case *ast.Symbol:
-		result, ok := e.Get(value.Name)
+		result, ok := lookupSymbol(e, value)
 		if !ok {
-			panicEvalError(value, "Name not defined: "+value.Name)
+			return signalUndefinedName(th, e, value, k)
 		}
-		return respond(result)
+		if dv, ok := result.(*DynamicVar); ok {
+			return resume(k, dynamicValue(th, dv))
+		}
+		return resume(k, result)
 	case *ast.Str:
-		return respond(value)
+		return resume(k, value)
 	case *ast.Char:
-		return respond(value)
+		return resume(k, value)
 	case *ast.List:
-		return bounce(func() packet { return evalList(e, value, true) })
+		return evalList(th, e, value, true, k)
 	case *ast.Nil:
-		return respond(&ast.Nil{})
+		return resume(k, &ast.Nil{})
 	default:
 		panicEvalError(n, "Unknown form to evaluate: "+value.String())
 	}
 
-	return respond(&ast.Nil{})
+	return resume(k, &ast.Nil{})
 }
 
-func evalList(e Env, l *ast.List, shouldEvalMacros bool) packet {
+func evalList(th *thread, e Env, l *ast.List, shouldEvalMacros bool, k *continuation) packet {
+	th.form = l
 	elements := l.Nodes
 
 	if len(elements) == 0 {
@@ -102,159 +213,319 @@ func evalList(e Env, l *ast.List, shouldEvalMacros bool) packet {
 
 	switch value := head.(type) {
 	case *ast.Symbol:
-		switch value.Name {
+		switch value.Base().Name {
 		case "def":
 			checkSpecialArgs("def", head, args, 2, 2)
-			return specialDef(e, head, args)
+			return specialDef(th, e, head, args, k)
+		case "defdynamic":
+			checkSpecialArgs("defdynamic", head, args, 2, 2)
+			return specialDefdynamic(th, e, head, args, k)
+		case "binding":
+			checkSpecialArgs("binding", head, args, 1, -1)
+			return specialBinding(th, e, head, args, k)
 		case "eval":
 			checkSpecialArgs("eval", head, args, 1, 2)
-			return specialEval(e, head, args)
+			return specialEval(th, e, head, args, k)
 		case "update!":
 			checkSpecialArgs("update!", head, args, 2, 2)
-			return specialUpdateBang(e, head, args)
+			return specialUpdateBang(th, e, head, args, k)
 		case "if":
 			checkSpecialArgs("if", head, args, 3, 3)
-			return specialIf(e, head, args)
+			return specialIf(th, e, head, args, k)
 		case "cond":
 			checkSpecialArgs("cond", head, args, 2, -1)
-			return specialCond(e, head, args)
+			return specialCond(th, e, head, args, k)
+		case "match":
+			checkSpecialArgs("match", head, args, 1, -1)
+			return specialMatch(th, e, head, args, k)
 		case "proc":
 			checkSpecialArgs("proc", head, args, 2, 2)
-			return specialFn(e, head, args)
+			return specialFn(th, e, l, args, k)
+		case "case-proc":
+			checkSpecialArgs("case-proc", head, args, 1, -1)
+			return specialCaseProc(th, e, l, args, k)
 		case "macro":
 			checkSpecialArgs("macro", head, args, 1, 1)
-			return specialMacro(e, head, args)
+			return specialMacro(th, e, head, args, k)
+		case "syntax-rules":
+			checkSpecialArgs("syntax-rules", head, args, 1, -1)
+			return specialSyntaxRules(th, e, head, args, k)
 		case "macroexpand1":
 			checkSpecialArgs("macroexpand1", head, args, 1, 1)
-			return specialMacroexpand1(e, head, args)
+			return specialMacroexpand1(th, e, head, args, k)
 		case "quote":
 			checkSpecialArgs("quote", head, args, 1, 1)
-			return specialQuote(e, head, args)
+			return specialQuote(th, e, head, args, k)
+		case "quasiquote":
+			checkSpecialArgs("quasiquote", head, args, 1, 1)
+			return specialQuasiquote(th, e, head, args, k)
+		case "unquote", "unquote-splicing":
+			panicEvalError(head, "'"+value.Base().Name+"' used outside of 'quasiquote'")
 		case "let":
 			checkSpecialArgs("let", head, args, 2, 2)
-			return specialLet(e, head, args)
+			return specialLet(th, e, head, args, k)
 		case "begin":
 			checkSpecialArgs("begin", head, args, 0, -1)
-			return specialBegin(e, head, args)
+			return specialBegin(th, e, head, args, k)
+		case "delay":
+			checkSpecialArgs("delay", head, args, 1, 1)
+			return specialDelay(th, e, head, args, k)
+		case "lazy-seq":
+			checkSpecialArgs("lazy-seq", head, args, 0, -1)
+			return specialLazySeq(th, e, head, args, k)
+		case "generator":
+			checkSpecialArgs("generator", head, args, 0, -1)
+			return specialGenerator(th, e, head, args, k)
 		case "go":
 			checkSpecialArgs("go", head, args, 0, -1)
-			return specialGo(e, head, args)
+			return specialGo(th, e, head, args, k)
+		case "try":
+			checkSpecialArgs("try", head, args, 0, -1)
+			return specialTry(th, e, head, args, k)
+		case "handler-bind":
+			checkSpecialArgs("handler-bind", head, args, 1, -1)
+			return specialHandlerBind(th, e, head, args, k)
+		case "restart-case":
+			checkSpecialArgs("restart-case", head, args, 1, -1)
+			return specialRestartCase(th, e, head, args, k)
+		case "call/cc":
+			checkSpecialArgs("call/cc", head, args, 1, 1)
+			return specialCallCC(th, e, head, args, k)
 		}
 	}
 
-	evaluatedHead := trampoline(func() packet {
-		return evalNode(e, head)
-	})
+	if evaluatedHead, ok := evalAtom(th, e, head); ok {
+		return evalCall(th, e, l, evaluatedHead, shouldEvalMacros, k)
+	}
+	return evalNode(th, e, head, then(th, func(th *thread, evaluatedHead ast.Node) packet {
+		return evalCall(th, e, l, evaluatedHead, shouldEvalMacros, k)
+	}))
+}
 
+// evalCall evaluates a list which is not a special form, given the value of
+// its head.
+func evalCall(th *thread, e Env, l *ast.List, evaluatedHead ast.Node, shouldEvalMacros bool, k *continuation) packet {
+	head := l.Nodes[0]
 	switch val := evaluatedHead.(type) {
 	case Routine:
-		return evalInvokeRoutine(e, val, head, args, shouldEvalMacros)
+		if f, ok := val.(*Procedure); ok && f.IsMacro && shouldEvalMacros {
+			return evalMacroCall(th, e, f, l, k)
+		}
+		return evalInvokeRoutine(th, e, val, head, l.Nodes[1:], shouldEvalMacros, k)
 	default:
 		panicEvalError(head, "First item in list not a routine: "+val.String())
 		return respond(&ast.Nil{})
 	}
 }
 
-func evalInvokeRoutine(e Env, r Routine, head ast.Node, unevaledArgs ast.Nodes, shouldEvalMacros bool) packet {
+// isSpecialForm reports whether a list whose head is the given symbol name is
+// a special form. It must agree with the names evalList dispatches on.
+func isSpecialForm(name string) bool {
+	switch name {
+	case "def", "defdynamic", "binding", "eval", "update!", "if", "cond",
+		"match", "proc", "case-proc", "macro", "syntax-rules", "macroexpand1", "quote",
+		"quasiquote", "unquote", "unquote-splicing", "let", "begin", "delay", "lazy-seq",
+		"generator", "go", "try", "handler-bind", "restart-case", "call/cc":
+		return true
+	}
+	return false
+}
+
+// evalInvokeRoutine invokes a routine with arguments which have not yet been
+// evaluated. The arguments of macros are passed on unevaluated.
+func evalInvokeRoutine(th *thread, e Env, r Routine, head ast.Node, unevaledArgs ast.Nodes, shouldEvalMacros bool, k *continuation) packet {
+	checkRoutineArgs(r, head, unevaledArgs)
+
+	if f, ok := r.(*Procedure); ok && f.IsMacro {
+		return bounce(func() packet {
+			return invokeRoutine(th, e, r, head, unevaledArgs, shouldEvalMacros, k)
+		})
+	}
+
+	// Simple arguments are evaluated straight away, and only if there is one
+	// which is not is a continuation needed for the rest
+	args := make([]ast.Node, 0, len(unevaledArgs))
+	for _, n := range unevaledArgs {
+		value, ok := evalSimple(th, e, n)
+		if !ok {
+			return evalEachNodeFrom(th, e, unevaledArgs, args, func(th *thread, args []ast.Node) packet {
+				return invokeRoutine(th, e, r, head, args, shouldEvalMacros, k)
+			})
+		}
+		args = append(args, value)
+	}
+	return invokeRoutine(th, e, r, head, args, shouldEvalMacros, k)
+}
+
+// applyRoutine invokes a routine with arguments which have already been
+// evaluated.
+func applyRoutine(th *thread, e Env, r Routine, head ast.Node, args ast.Nodes, k *continuation) packet {
+	checkRoutineArgs(r, head, args)
+
+	return bounce(func() packet {
+		return invokeRoutine(th, e, r, head, args, true, k)
+	})
+}
+
+func invokeRoutine(th *thread, e Env, r Routine, head ast.Node, args ast.Nodes, shouldEvalMacros bool, k *continuation) packet {
 	switch val := r.(type) {
 	case *Primitive:
-		f := val.Value
-		checkPrimitiveArgs(val.Name, head, unevaledArgs, val.MinArity, val.MaxArity)
-		return respond(f(e, head, evalEachNode(e, unevaledArgs)))
+		if val.Control != nil {
+			return val.Control(th, e, head, args, k)
+		}
+		return resume(k, val.Value(th.interp, e, head, args))
 	case *Procedure:
-		return bounce(func() packet {
-			return evalInvokeProcedure(e, val, head, unevaledArgs, shouldEvalMacros)
-		})
+		return evalInvokeProcedure(th, e, val, head, args, shouldEvalMacros, k)
+	case *Continuation:
+		// Reinstate the error handlers and restarts which were in place when
+		// the continuation was captured
+		th.dynamicState = val.state
+		if len(args) == 0 {
+			return resume(val.K, &ast.Nil{})
+		}
+		return resume(val.K, args[0])
 	default:
 		panicEvalError(head, "Unrecognized routine type: "+val.String())
 		return respond(&ast.Nil{})
 	}
 }
 
-func evalInvokeProcedure(dynamicEnv Env, f *Procedure, head ast.Node, unevaledArgs ast.Nodes, shouldEvalMacros bool) packet {
-	defer func() {
-		if e := recover(); e != nil {
-			switch errorValue := e.(type) {
-			case *EvalError:
-				fmt.Printf("TRACE: (%v: %v): call to %v\n", head.Loc().Filename, head.Loc().Line, f.Name)
-				panic(errorValue)
-			default:
-				panic(errorValue)
-			}
-		}
-	}()
-
-	// Validate parameters
-	isVariableNumberOfParams := false
-	for _, param := range f.Parameters {
-		switch paramVal := param.(type) {
-		case *ast.Symbol:
-			if paramVal.Name == "&rest" {
-				isVariableNumberOfParams = true
-			}
-		default:
-			panicEvalError(head, "Procedure parameters should only be symbols: "+param.String())
-		}
+func checkRoutineArgs(r Routine, head ast.Node, args ast.Nodes) {
+	switch val := r.(type) {
+	case *Primitive:
+		checkPrimitiveArgs(val.Name, head, args, val.MinArity, val.MaxArity)
+	case *Procedure:
+		checkProcedureArgs(val, head, args)
+	case *Continuation:
+		checkBuiltinArgs("Continuation", val.RoutineName(), head, args, 0, 1)
 	}
-	if !isVariableNumberOfParams {
-		if len(unevaledArgs) != len(f.Parameters) {
+}
+
+func checkProcedureArgs(f *Procedure, head ast.Node, args ast.Nodes) {
+	if len(f.Clauses) > 0 {
+		if f.clauseFor(len(args)) == nil {
 			panicEvalError(head, fmt.Sprintf(
-				"Procedure '%v' expects %v argument(s), but was given %v. Procedure parameter list: %v. Arguments: %v.",
+				"Procedure '%v'%v expects %v argument(s), but was given %v. Procedure parameter lists: %v. Arguments: %v.",
 				f.Name,
-				len(f.Parameters),
-				len(unevaledArgs),
-				f.Parameters,
-				unevaledArgs))
+				describeDefinition(f),
+				describeClauseArities(f.Clauses),
+				len(args),
+				clauseParameters(f),
+				args))
 		}
+		return
 	}
 
-	// Create the lexical environment based on the procedure's lexical parent
-	lexicalEnv := NewMapEnv(f.Name, f.ParentEnv)
+	minArity, maxArity := f.parameterList(head).arity()
+	if len(args) < minArity || (maxArity != -1 && len(args) > maxArity) {
+		panicEvalError(head, fmt.Sprintf(
+			"Procedure '%v'%v expects %v argument(s), but was given %v. Procedure parameter list: %v. Arguments: %v.",
+			f.Name,
+			describeDefinition(f),
+			describeArity(minArity, maxArity),
+			len(args),
+			f.Parameters,
+			args))
+	}
+}
 
-	// Prepare the arguments for application
-	var args []ast.Node
-	if f.IsMacro {
-		args = unevaledArgs
-	} else {
-		args = evalEachNode(dynamicEnv, unevaledArgs)
-	}
-
-	// Map arguments to parameters
-	isMappingRestArgs := false
-	iarg := 0
-	for iparam, param := range f.Parameters {
-		paramName := toSymbolName(param)
-		if isMappingRestArgs {
-			restArgs := args[iarg:]
-			restList := ast.NewList(restArgs)
-			lexicalEnv.Set(paramName, restList)
-		} else if paramName == "&rest" {
-			isMappingRestArgs = true
-		} else {
-			lexicalEnv.Set(paramName, args[iparam])
-			iarg++
+// describeDefinition describes where a procedure was defined, if known.
+func describeDefinition(f *Procedure) string {
+	if f.Location == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (defined at %v:%v)", f.Location.Filename, f.Location.Line)
+}
+
+func describeArity(minArity, maxArity int) string {
+	switch maxArity {
+	case -1:
+		return fmt.Sprintf("at least %v", minArity)
+	case minArity:
+		return fmt.Sprintf("%v", minArity)
+	default:
+		return fmt.Sprintf("between %v and %v", minArity, maxArity)
+	}
+}
+
+// describeClauseArities lists the numbers of arguments accepted by the clauses
+// of a procedure, as in "1, 2 or at least 4".
+func describeClauseArities(clauses []*Procedure) string {
+	s := ""
+	for i, clause := range clauses {
+		switch {
+		case i == 0:
+		case i == len(clauses)-1:
+			s += " or "
+		default:
+			s += ", "
 		}
+		s += describeArity(clause.Arity())
 	}
+	return s
+}
 
-	if f.IsMacro {
-		expandedMacro := trampoline(func() packet {
-			return evalNode(lexicalEnv, f.Body)
-		})
+// clauseParameters returns the parameter lists of each clause of a procedure.
+func clauseParameters(f *Procedure) *ast.List {
+	params := make([]ast.Node, len(f.Clauses))
+	for i, clause := range f.Clauses {
+		params[i] = ast.NewList(clause.Parameters)
+	}
+	return ast.NewList(params)
+}
 
-		if shouldEvalMacros {
-			return bounce(func() packet {
+func evalInvokeProcedure(th *thread, dynamicEnv Env, f *Procedure, head ast.Node, args ast.Nodes, shouldEvalMacros bool, k *continuation) packet {
+	bodyK := k
+	if f.IsMacro {
+		// The expansion is evaluated once the macro procedure has returned
+		loc := locate(head, th.form)
+		bodyK = then(th, func(th *thread, expandedMacro ast.Node) packet {
+			if shouldEvalMacros {
 				// This is executed in the environment of its application, not the
 				// environment of its definition
-				return evalNode(dynamicEnv, expandedMacro)
-			})
-		}
-		return respond(expandedMacro)
+				locateExpansion(expandedMacro, loc)
+				return prepare(th.interp.Engine, expandedMacro).exec(th, dynamicEnv, k)
+			}
+			return resume(k, expandedMacro)
+		})
 	}
 
-	// Evaluate the body in the new lexical environment
-	return bounce(func() packet {
-		return evalNode(lexicalEnv, f.Body)
-	})
+	pushFrame(th, f, head, args, bodyK)
+
+	// A procedure with several arities runs the clause for the number of
+	// arguments given
+	clause := f.clauseFor(len(args))
+
+	// Create the lexical environment based on the procedure's lexical parent
+	params := clause.parameterList(head)
+	lexicalEnv := newProcedureEnv(th, f, params, clause.ParentEnv)
+
+	// Map arguments to parameters, then evaluate the body in the new lexical
+	// environment
+	if len(params.optional) == 0 && len(params.keys) == 0 {
+		// There are no default values to evaluate, so the body is evaluated
+		// as soon as the arguments are bound
+		bindRequiredParameters(lexicalEnv, params, args)
+		return startBody(clause, lexicalEnv, bodyK)
+	}
+	return bindParameters(th, lexicalEnv, params, head, args, then(th, func(th *thread, _ ast.Node) packet {
+		return startBody(clause, lexicalEnv, bodyK)
+	}))
+}
+
+// locateExpansion gives the lists built by a macro, which have no location of
+// their own, the location of the macro's call site.
+func locateExpansion(n ast.Node, loc *token.Location) {
+	if loc == nil {
+		return
+	}
+
+	if l, ok := n.(*ast.List); ok && l.Location == nil {
+		l.Location = loc
+		for _, child := range l.Nodes {
+			locateExpansion(child, loc)
+		}
+	}
 }
 
 func checkSpecialArgs(name string, head ast.Node, args []ast.Node, paramCountMin int, paramCountMax int) {
@@ -298,10 +569,22 @@ func checkBuiltinArgs(builtinType string, name string, head ast.Node, args []ast
 	}
 }
 
+// isKeyword reports whether the node is the given symbol, such as '&rest' or
+// 'catch', which has a special meaning in the form it appears in. A symbol
+// renamed by a hygienic macro keeps the meaning of the symbol it stands for.
+func isKeyword(n ast.Node, name string) bool {
+	symbol, ok := n.(*ast.Symbol)
+	return ok && symbol.Base().Name == name
+}
+
 func toSymbolName(n ast.Node) string {
+	return toSymbol(n).Name
+}
+
+func toSymbol(n ast.Node) *ast.Symbol {
 	switch value := n.(type) {
 	case *ast.Symbol:
-		return value.Name
+		return value
 	}
 
 	panic("Not a symbol: " + n.String())
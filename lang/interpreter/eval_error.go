@@ -2,6 +2,8 @@ package interpreter
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/onlyafly/vamos/lang/ast"
 	"github.com/onlyafly/vamos/lang/token"
@@ -11,12 +13,25 @@ import (
 type EvalError struct {
 	SuperMessage string
 	Message      string
+	Data         ast.Node   // Any value attached to the error by 'raise'
+	Restarts     []*Restart // The restarts available when the error escaped evaluation
 	location     *token.Location
+	node         ast.Node // The node the error was raised at, if it has no location of its own
+
+	raised     bool           // Whether the error has been raised, so that the calls in progress are recorded
+	calls      *procedureCall // The procedure calls in progress when the error was raised, innermost first
+	frames     []*Frame
+	framesOnce sync.Once
 }
 
 // NewEvalError returns a new EvalError
 func NewEvalError(superMessage, message string, location *token.Location) *EvalError {
-	return &EvalError{superMessage, message, location}
+	return &EvalError{
+		SuperMessage: superMessage,
+		Message:      message,
+		Data:         &ast.Nil{},
+		location:     location,
+	}
 }
 
 // Implements the error interface
@@ -28,18 +43,97 @@ func (e *EvalError) Error() string {
 	return fmt.Sprintf("%v: %v", e.SuperMessage, e.Message)
 }
 
-func panicEvalError(n ast.Node, s string) {
-	var loc *token.Location
-	if n != nil {
-		loc = n.Loc()
+// Location returns where the error occurred, if known.
+func (e *EvalError) Location() *token.Location {
+	return e.location
+}
+
+// Frames describes the procedure calls which were in progress when the error
+// was raised, innermost first. The calls are only described when the frames
+// are first asked for, since most errors, such as those caught by 'try', are
+// never seen in a traceback.
+func (e *EvalError) Frames() []*Frame {
+	e.framesOnce.Do(func() {
+		e.frames = callStack(e.calls)
+	})
+	return e.frames
+}
+
+// tracebackEnds is how many of the innermost and of the outermost calls a
+// traceback lists when there are too many to list them all.
+const tracebackEnds = 10
+
+// Traceback lists the procedure calls which were in progress when the error
+// was raised, innermost first, one per line. Only the innermost and outermost
+// calls of a very deep stack are listed.
+func (e *EvalError) Traceback() string {
+	frames := e.Frames()
+	omitted := 0
+	if len(frames) > 2*tracebackEnds+1 {
+		omitted = len(frames) - 2*tracebackEnds
+		frames = append(frames[:tracebackEnds:tracebackEnds], frames[len(frames)-tracebackEnds:]...)
+	}
+
+	var lines []string
+	for i, f := range frames {
+		if omitted > 0 && i == tracebackEnds {
+			lines = append(lines, fmt.Sprintf("  ... %v more calls ...", omitted))
+		}
+		lines = append(lines, "  in "+f.String())
 	}
-	panic(NewEvalError("Evaluation error", s, loc))
+	return strings.Join(lines, "\n")
+}
+
+func panicEvalError(n ast.Node, s string) {
+	panic(newEvalErrorAt("Evaluation error", s, n))
 }
 
 func panicApplicationError(n ast.Node, s string) {
-	var loc *token.Location
-	if n != nil {
-		loc = n.Loc()
+	panic(newEvalErrorAt("Application panic", s, n))
+}
+
+// newEvalErrorAt returns a new EvalError raised at a node. A node without a
+// location of its own, such as an interned symbol, is located once the error
+// reaches the trampoline, in the form the thread was evaluating.
+func newEvalErrorAt(superMessage, message string, n ast.Node) *EvalError {
+	if n == nil {
+		return NewEvalError(superMessage, message, nil)
+	}
+	err := NewEvalError(superMessage, message, n.Loc())
+	if err.location == nil {
+		err.node = n
+	}
+	return err
+}
+
+// locate returns where a node was read. A node without a location of its own,
+// such as an interned symbol, is looked for in the form it was evaluated in,
+// and otherwise given the location of that form.
+func locate(n ast.Node, form *ast.List) *token.Location {
+	if loc := n.Loc(); loc != nil || form == nil {
+		return loc
+	}
+	if loc := locateIn(form, n); loc != nil {
+		return loc
+	}
+	return form.Location
+}
+
+// locateIn returns where the first occurrence of a node in a form was read, or
+// nil if it does not occur in the form.
+func locateIn(form *ast.List, n ast.Node) *token.Location {
+	for i, child := range form.Nodes {
+		if child == n {
+			if loc := form.LocOf(i); loc != nil {
+				return loc
+			}
+			return form.Location
+		}
+		if l, ok := child.(*ast.List); ok {
+			if loc := locateIn(l, n); loc != nil {
+				return loc
+			}
+		}
 	}
-	panic(NewEvalError("Application panic", s, loc))
+	return nil
 }
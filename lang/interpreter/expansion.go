@@ -0,0 +1,241 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Macro Expansion
+
+// evalMacroCall evaluates a call to a macro with the engine of the
+// interpreter. Each call site is expanded and the expansion prepared for the
+// engine only the first time it is evaluated; after that, the expansion is
+// reused as long as the head of the call still refers to the same macro.
+func evalMacroCall(th *thread, e Env, f *Procedure, l *ast.List, k *continuation) packet {
+	if x := l.Expansion(); x != nil && x.Macro == f {
+		prepared := x.Prepared.(*preparedForm)
+		if prepared.engine != th.interp.Engine {
+			prepared = prepare(th.interp.Engine, x.Form)
+			l.SetExpansion(&ast.Expansion{Macro: f, Form: x.Form, Prepared: prepared})
+		}
+		return prepared.exec(th, e, k)
+	}
+
+	th.form = l
+	head := l.Nodes[0]
+	return evalInvokeRoutine(th, e, f, head, l.Nodes[1:], false, then(th, func(th *thread, expansion ast.Node) packet {
+		locateExpansion(expansion, l.LocOf(0))
+		prepared := prepare(th.interp.Engine, expansion)
+		l.SetExpansion(&ast.Expansion{Macro: f, Form: expansion, Prepared: prepared})
+
+		// This is executed in the environment of its application, not the
+		// environment of its definition
+		return prepared.exec(th, e, k)
+	}))
+}
+
+// expandAll expands the macro calls in a form. Quoted data is left alone, as
+// are calls whose head names a variable bound within the form, such as a
+// procedure parameter, rather than a macro.
+func expandAll(th *thread, e Env, n ast.Node, bound map[string]bool, k *continuation) packet {
+	l, ok := n.(*ast.List)
+	if !ok || len(l.Nodes) == 0 {
+		return resume(k, n)
+	}
+
+	symbol, ok := l.Nodes[0].(*ast.Symbol)
+	if !ok {
+		return expandAllFrom(th, e, l, 0, bound, k)
+	}
+
+	switch symbol.Base().Name {
+	case "quote", "quasiquote", "syntax-rules":
+		return resume(k, l)
+	case "def", "defdynamic", "update!":
+		return expandAllFrom(th, e, l, 2, bound, k)
+	case "proc":
+		if len(l.Nodes) < 2 {
+			return resume(k, l)
+		}
+		return expandAllFrom(th, e, l, 2, bindNames(bound, l.Nodes[1]), k)
+	case "let":
+		return expandAllLet(th, e, l, bound, k)
+	case "case-proc":
+		return expandAllClauses(th, e, l, 1, bound, k)
+	case "binding":
+		return expandAllBinding(th, e, l, bound, k)
+	case "match":
+		return expandAllMatch(th, e, l, bound, k)
+	case "try":
+		return expandAllClauses(th, e, l, 1, bound, k)
+	case "restart-case":
+		return expandAllClauses(th, e, l, 2, bound, k)
+	}
+
+	if !bound[symbol.Name] {
+		if value, ok := lookupSymbol(e, symbol); ok {
+			if f, ok := value.(*Procedure); ok && f.IsMacro {
+				th.form = l
+				return evalInvokeRoutine(th, e, f, l.Nodes[0], l.Nodes[1:], false, then(th, func(th *thread, expansion ast.Node) packet {
+					locateExpansion(expansion, l.LocOf(0))
+					return expandAll(th, e, expansion, bound, k)
+				}))
+			}
+		}
+	}
+
+	return expandAllFrom(th, e, l, 0, bound, k)
+}
+
+// expandAllFrom expands the elements of a list starting at the given index.
+func expandAllFrom(th *thread, e Env, l *ast.List, from int, bound map[string]bool, k *continuation) packet {
+	return expandAllEach(th, e, l, func(i int) bool { return i >= from }, bound, k)
+}
+
+// expandAllLet expands the values and the body of a let form, in which the
+// names of all the variables are bound.
+func expandAllLet(th *thread, e Env, l *ast.List, bound map[string]bool, k *continuation) packet {
+	if len(l.Nodes) < 3 {
+		return resume(k, l)
+	}
+	bindings, ok := l.Nodes[1].(*ast.List)
+	if !ok {
+		return resume(k, l)
+	}
+
+	var names []ast.Node
+	for i := 0; i < len(bindings.Nodes); i += 2 {
+		names = append(names, bindings.Nodes[i])
+	}
+	bound = bindNames(bound, ast.NewList(names))
+
+	return expandAllEach(th, e, bindings, func(i int) bool { return i%2 == 1 }, bound, then(th, func(th *thread, expandedBindings ast.Node) packet {
+		return expandAll(th, e, l.Nodes[2], bound, then(th, func(th *thread, body ast.Node) packet {
+			return resume(k, &ast.List{Nodes: []ast.Node{l.Nodes[0], expandedBindings, body}, Location: l.Location, Locations: l.Locations})
+		}))
+	}))
+}
+
+// expandAllBinding expands the values and the body of a binding form. Unlike
+// let, it binds no names lexically.
+func expandAllBinding(th *thread, e Env, l *ast.List, bound map[string]bool, k *continuation) packet {
+	if len(l.Nodes) < 2 {
+		return resume(k, l)
+	}
+	bindings, ok := l.Nodes[1].(*ast.List)
+	if !ok {
+		return resume(k, l)
+	}
+
+	return expandAllEach(th, e, bindings, func(i int) bool { return i%2 == 1 }, bound, then(th, func(th *thread, expandedBindings ast.Node) packet {
+		rest := &ast.List{Nodes: append([]ast.Node{l.Nodes[0], expandedBindings}, l.Nodes[2:]...), Location: l.Location, Locations: l.Locations}
+		return expandAllFrom(th, e, rest, 2, bound, k)
+	}))
+}
+
+// expandAllMatch expands the value and the bodies of a match form, each body
+// with the variables of its pattern bound. The patterns are left alone.
+func expandAllMatch(th *thread, e Env, l *ast.List, bound map[string]bool, k *continuation) packet {
+	return expandAllMatchFrom(th, e, l, 1, append([]ast.Node{}, l.Nodes...), bound, k)
+}
+
+func expandAllMatchFrom(th *thread, e Env, l *ast.List, i int, expanded []ast.Node, bound map[string]bool, k *continuation) packet {
+	if i >= len(l.Nodes) {
+		return resume(k, &ast.List{Nodes: expanded, Location: l.Location, Locations: l.Locations})
+	}
+
+	// The value comes first, followed by pairs of patterns and bodies
+	bodyBound := bound
+	if i > 1 {
+		bodyBound = bindNames(bound, l.Nodes[i-1])
+	}
+
+	return expandAll(th, e, l.Nodes[i], bodyBound, then(th, func(th *thread, n ast.Node) packet {
+		next := make([]ast.Node, len(expanded))
+		copy(next, expanded)
+		next[i] = n
+		return expandAllMatchFrom(th, e, l, i+2, next, bound, k)
+	}))
+}
+
+// expandAllClauses expands a form whose elements after the first few may be
+// clauses, such as (catch e ...) in 'try', (name (params...) ...) in
+// 'restart-case' or ((params...) body) in 'case-proc', whose bodies are
+// expanded with the names they bind.
+func expandAllClauses(th *thread, e Env, l *ast.List, from int, bound map[string]bool, k *continuation) packet {
+	return expandAllFrom(th, e, &ast.List{Nodes: l.Nodes[:from], Location: l.Location, Locations: l.Locations}, 1, bound, then(th, func(th *thread, expandedHead ast.Node) packet {
+		return expandAllClausesFrom(th, e, l, from, expandedHead.(*ast.List).Nodes, bound, k)
+	}))
+}
+
+func expandAllClausesFrom(th *thread, e Env, l *ast.List, i int, expanded []ast.Node, bound map[string]bool, k *continuation) packet {
+	if i >= len(l.Nodes) {
+		return resume(k, &ast.List{Nodes: expanded, Location: l.Location, Locations: l.Locations})
+	}
+
+	next := func(th *thread, n ast.Node) packet {
+		extended := make([]ast.Node, len(expanded), len(expanded)+1)
+		copy(extended, expanded)
+		return expandAllClausesFrom(th, e, l, i+1, append(extended, n), bound, k)
+	}
+
+	node := l.Nodes[i]
+	clause, ok := node.(*ast.List)
+	switch {
+	case ok && len(clause.Nodes) >= 2 && isKeyword(clause.Nodes[0], "catch"):
+		return expandAllFrom(th, e, clause, 2, bindNames(bound, ast.NewList(clause.Nodes[1:2])), then(th, next))
+	case ok && len(clause.Nodes) >= 1 && isKeyword(clause.Nodes[0], "finally"):
+		return expandAllFrom(th, e, clause, 1, bound, then(th, next))
+	case ok && len(clause.Nodes) >= 2 && isKeyword(l.Nodes[0], "restart-case"):
+		return expandAllFrom(th, e, clause, 2, bindNames(bound, clause.Nodes[1]), then(th, next))
+	case ok && len(clause.Nodes) == 2 && isKeyword(l.Nodes[0], "case-proc"):
+		return expandAllFrom(th, e, clause, 1, bindNames(bound, clause.Nodes[0]), then(th, next))
+	}
+
+	return expandAll(th, e, node, bound, then(th, next))
+}
+
+// expandAllEach expands the elements of a list for which expandable returns
+// true, leaving the others as they are.
+func expandAllEach(th *thread, e Env, l *ast.List, expandable func(int) bool, bound map[string]bool, k *continuation) packet {
+	return expandAllEachFrom(th, e, l, expandable, make([]ast.Node, 0, len(l.Nodes)), bound, k)
+}
+
+func expandAllEachFrom(th *thread, e Env, l *ast.List, expandable func(int) bool, expanded []ast.Node, bound map[string]bool, k *continuation) packet {
+	i := len(expanded)
+	if i == len(l.Nodes) {
+		return resume(k, &ast.List{Nodes: expanded, Location: l.Location, Locations: l.Locations})
+	}
+
+	next := func(th *thread, n ast.Node) packet {
+		// A continuation may be resumed more than once, so the results gathered
+		// so far are copied rather than appended to in place
+		extended := make([]ast.Node, i, len(l.Nodes))
+		copy(extended, expanded)
+		return expandAllEachFrom(th, e, l, expandable, append(extended, n), bound, k)
+	}
+
+	if !expandable(i) {
+		return next(th, l.Nodes[i])
+	}
+	return expandAll(th, e, l.Nodes[i], bound, then(th, next))
+}
+
+// bindNames returns the set of bound names extended with the symbols in a
+// list of parameter patterns.
+func bindNames(bound map[string]bool, params ast.Node) map[string]bool {
+	extended := make(map[string]bool, len(bound))
+	for name := range bound {
+		extended[name] = true
+	}
+	addPatternNames(extended, params)
+	return extended
+}
+
+func addPatternNames(names map[string]bool, pattern ast.Node) {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		names[p.Name] = true
+	case *ast.List:
+		for _, child := range p.Nodes {
+			addPatternNames(names, child)
+		}
+	}
+}
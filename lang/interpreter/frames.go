@@ -0,0 +1,120 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+// maxFrameArgumentsLength is the length in characters beyond which the summary
+// of the arguments of a frame is cut short.
+const maxFrameArgumentsLength = 60
+
+////////// Frame
+
+// Frame is a procedure call which was in progress when an error was raised.
+type Frame struct {
+	ProcedureName string
+	Filename      string
+	Line          int
+	Column        int
+	Arguments     string // A summary of the arguments the procedure was called with
+}
+
+// String returns the frame as it appears in a traceback.
+func (f *Frame) String() string {
+	return fmt.Sprintf("%v (%v: %v:%v) called with %v", f.ProcedureName, f.Filename, f.Line, f.Column, f.Arguments)
+}
+
+// A procedureCall is a call to a procedure which is in progress. The calls
+// of a thread are linked from the innermost out, and are shared with the
+// continuations captured during them and the threads those are resumed by,
+// so a call is never changed once it is made.
+type procedureCall struct {
+	procedure *Procedure
+	head      ast.Node  // The head of the call, which gives its location
+	form      *ast.List // The form being evaluated when the call was made, in which the head is located
+	args      ast.Nodes
+	depth     int // How many calls there are, counting this one and its parents
+	parent    *procedureCall
+}
+
+// pushFrame records a call to a procedure, which will return to the call
+// stack of the continuation k. It raises an error if that would make the stack
+// deeper than the thread allows.
+func pushFrame(th *thread, f *Procedure, head ast.Node, args ast.Nodes, k *continuation) {
+	c := &procedureCall{
+		procedure: f,
+		head:      head,
+		form:      th.form,
+		args:      args,
+		depth:     th.baseDepth + 1,
+		parent:    k.frames,
+	}
+	if k.frames != nil {
+		c.depth = k.frames.depth + 1
+	}
+
+	th.frames = c
+
+	if th.maxDepth >= 0 && c.depth > th.maxDepth {
+		panicEvalError(head, depthExceededMessage(th))
+	}
+}
+
+func depthExceededMessage(th *thread) string {
+	return fmt.Sprintf("Stack depth exceeded: more than %v procedure calls in progress", th.maxDepth)
+}
+
+// callStack describes procedure calls, innermost first. The arguments of the
+// calls are only summarized here, since most calls are never seen in a
+// traceback.
+func callStack(calls *procedureCall) []*Frame {
+	frames := make([]*Frame, 0)
+	for c := calls; c != nil; c = c.parent {
+		frame := &Frame{
+			ProcedureName: c.procedure.Name,
+			Arguments:     summarizeArguments(c.args),
+		}
+		if c.head != nil {
+			if loc := locate(c.head, c.form); loc != nil {
+				frame.Filename = loc.Filename
+				frame.Line = loc.Line
+				frame.Column = loc.Column
+			}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// summarizeArguments describes the arguments of a call. Lazy sequences are
+// described by the elements realized so far, since recording a call should
+// neither realize them nor, if they are infinite, fail to finish.
+func summarizeArguments(args ast.Nodes) string {
+	summary := summarizeNode(ast.NewList(args))
+	if utf8.RuneCountInString(summary) > maxFrameArgumentsLength {
+		runes := []rune(summary)
+		return strings.TrimRight(string(runes[:maxFrameArgumentsLength-4]), " ") + " ...)"
+	}
+	return summary
+}
+
+func summarizeNode(n ast.Node) string {
+	switch val := n.(type) {
+	case *ast.LazySeq:
+		return val.RealizedString()
+	case *ast.List:
+		if val.Annotation() != nil {
+			return val.String()
+		}
+		parts := make([]string, len(val.Nodes))
+		for i, child := range val.Nodes {
+			parts[i] = summarizeNode(child)
+		}
+		return "(" + strings.Join(parts, " ") + ")"
+	}
+	return n.String()
+}
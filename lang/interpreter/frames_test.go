@@ -0,0 +1,126 @@
+package interpreter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+func TestEvalError_Frames(t *testing.T) {
+	nodes, _ := parser.Parse(`
+(def f (proc (a b) (first a)))
+(def g (proc () (list (f 1 "two"))))
+(g)`, "frames.v")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+
+	var err error
+	for _, n := range nodes {
+		if _, err = in.Eval(n); err != nil {
+			break
+		}
+	}
+
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		t.Fatalf("Expected an EvalError, got <%v>", err)
+	}
+
+	testhelp.CheckEqualInt(t, 2, len(evalErr.Frames()))
+
+	f := evalErr.Frames()[0]
+	testhelp.CheckEqualString(t, "f", f.ProcedureName)
+	testhelp.CheckEqualString(t, "frames.v", f.Filename)
+	testhelp.CheckEqualInt(t, 3, f.Line)
+	testhelp.CheckEqualInt(t, 24, f.Column)
+	testhelp.CheckEqualString(t, `(1 "two")`, f.Arguments)
+
+	testhelp.CheckEqualString(t,
+		"  in f (frames.v: 3:24) called with (1 \"two\")\n"+
+			"  in g (frames.v: 4:2) called with ()",
+		evalErr.Traceback())
+
+	// Nothing is written to the output while the error is raised
+	testhelp.CheckEqualString(t, "", out.String())
+}
+
+func TestEvalError_FramesOfSharedSymbol(t *testing.T) {
+	// Both calls of f share the interned symbol, so each is located by the form
+	// it was made in
+	nodes, _ := parser.Parse(`
+(def f (proc (x) (first x)))
+(def g (proc () (list (f '(1))
+                      (f 2))))
+(g)`, "frames.v")
+
+	for _, engine := range []Engine{ClosureCompiler, TreeWalker, BytecodeVM} {
+		in := New(&bytes.Buffer{}, func() string { return "" })
+		in.Engine = engine
+
+		var err error
+		for _, n := range nodes {
+			if _, err = in.Eval(n); err != nil {
+				break
+			}
+		}
+
+		evalErr, ok := err.(*EvalError)
+		if !ok {
+			t.Fatalf("Expected an EvalError, got <%v>", err)
+		}
+		testhelp.CheckEqualString(t, "Evaluation error (frames.v: 4): Cannot get first from a non-collection: 2", evalErr.Error())
+		testhelp.CheckEqualInt(t, 4, evalErr.Frames()[0].Line)
+		testhelp.CheckEqualInt(t, 24, evalErr.Frames()[0].Column)
+	}
+}
+
+func TestEvalError_TracebackOfDeepStack(t *testing.T) {
+	evalErr := NewEvalError("Evaluation error", "oops", nil)
+	for i := 24; i >= 0; i-- {
+		evalErr.calls = &procedureCall{procedure: &Procedure{Name: fmt.Sprintf("f%v", i)}, parent: evalErr.calls}
+	}
+
+	lines := strings.Split(evalErr.Traceback(), "\n")
+	testhelp.CheckEqualInt(t, 21, len(lines))
+	testhelp.CheckEqualString(t, "  in "+evalErr.Frames()[9].String(), lines[9])
+	testhelp.CheckEqualString(t, "  ... 5 more calls ...", lines[10])
+	testhelp.CheckEqualString(t, "  in "+evalErr.Frames()[15].String(), lines[11])
+	testhelp.CheckEqualString(t, "  in "+evalErr.Frames()[24].String(), lines[20])
+}
+
+func TestCallStack_SharedCalls(t *testing.T) {
+	// The calls captured by a continuation are shared by every thread which
+	// resumes it, so several threads may describe the same calls at once
+	shared := &procedureCall{
+		procedure: &Procedure{Name: "f"},
+		args:      ast.Nodes{&ast.Number{Value: 1}},
+		depth:     1,
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			th := &thread{frames: &procedureCall{procedure: &Procedure{Name: "g"}, depth: 2, parent: shared}}
+			frames := callStack(th.frames)
+			testhelp.CheckEqualInt(t, 2, len(frames))
+			testhelp.CheckEqualString(t, "()", frames[0].Arguments)
+			testhelp.CheckEqualString(t, "(1)", frames[1].Arguments)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSummarizeArguments_CutShortByCharacters(t *testing.T) {
+	summary := summarizeArguments(ast.Nodes{ast.NewStr(strings.Repeat("é", 100))})
+	testhelp.CheckEqualString(t, `("`+strings.Repeat("é", 54)+" ...)", summary)
+}
@@ -0,0 +1,73 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Generators
+
+// A generator runs its body a step at a time, each step lasting until the
+// body yields a value or finishes. Between steps it holds on to nothing but
+// the continuation of the body, so a generator which is no longer needed is
+// simply garbage collected, unlike a goroutine blocked on a channel.
+type generator struct {
+	origin origin
+	resume func(th *thread) packet // Runs the next step of the body
+	done   bool
+}
+
+// specialGenerator creates a lazy sequence of the values yielded by the body
+// forms. The body is run as far as the next 'yield' each time another element
+// of the sequence is needed.
+func specialGenerator(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	g := &generator{origin: originOf(th)}
+
+	g.resume = func(th *thread) packet {
+		return evalSequence(th, e, args, then(th, func(th *thread, _ ast.Node) packet {
+			g.done = true
+			return respond(&ast.Nil{})
+		}))
+	}
+
+	return resume(k, ast.NewLazySeq(g.next))
+}
+
+// next runs the body of the generator until it yields a value, which becomes
+// the first element of the rest of the sequence.
+func (g *generator) next() ast.Coll {
+	if g.done {
+		return &ast.Nil{}
+	}
+
+	value := evalNested(g.origin, func(th *thread) packet {
+		th.generator = g
+		return g.resume(th)
+	})
+
+	if g.done {
+		return &ast.Nil{}
+	}
+	return lazyCons(value, g.next)
+}
+
+// primYield suspends the body of the innermost generator of the thread,
+// handing it a value. The body carries on from here, with 'yield' returning
+// nil, when the next element of the generator is needed.
+func primYield(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	g := th.generator
+	if g == nil {
+		panicEvalError(head, "'yield' used outside of a generator")
+	}
+
+	// Error handlers and restarts established within the body are reinstated
+	// when it is resumed
+	state := th.dynamicState
+	g.resume = func(th *thread) packet {
+		th.dynamicState = state
+		return resume(k, &ast.Nil{})
+	}
+
+	var value ast.Node = &ast.Nil{}
+	if len(args) > 0 {
+		value = args[0]
+	}
+	return respond(value)
+}
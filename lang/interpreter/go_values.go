@@ -0,0 +1,498 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+var (
+	nodeType  = reflect.TypeOf((*ast.Node)(nil)).Elem()
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	anyType   = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+////////// Go to Vamos
+
+// ToValue converts a Go value to a Vamos value. Booleans, numbers, strings,
+// slices, arrays, maps, errors and functions become their Vamos counterparts,
+// and any ast.Node is returned unchanged. Any other value, such as a pointer
+// or a struct, is wrapped in a GoValue.
+func ToValue(x interface{}) ast.Node {
+	return toValue(reflect.ValueOf(x))
+}
+
+func toValue(x reflect.Value) ast.Node {
+	if !x.IsValid() || isNilValue(x) {
+		return &ast.Nil{}
+	}
+	if x.Type().Implements(nodeType) {
+		return x.Interface().(ast.Node)
+	}
+	if x.Type().Implements(errorType) {
+		return toErrorNode(x.Interface().(error))
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		if x.Bool() {
+			return trueSymbol
+		}
+		return falseSymbol
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &ast.Number{Value: float64(x.Int())}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &ast.Number{Value: float64(x.Uint())}
+	case reflect.Float32, reflect.Float64:
+		return &ast.Number{Value: x.Float()}
+	case reflect.String:
+		return ast.NewStr(x.String())
+	case reflect.Slice, reflect.Array:
+		nodes := make([]ast.Node, x.Len())
+		for i := range nodes {
+			nodes[i] = toValue(x.Index(i))
+		}
+		return ast.NewList(nodes)
+	case reflect.Map:
+		return mapToValue(x)
+	case reflect.Func:
+		if p, err := newGoPrimitive("go-func", x); err == nil {
+			return p
+		}
+	case reflect.Interface:
+		return toValue(x.Elem())
+	}
+
+	return NewGoValue(x.Interface())
+}
+
+// mapToValue converts a map to a list of (key value) lists, sorted by key so
+// that the same map always gives the same list.
+func mapToValue(m reflect.Value) ast.Node {
+	pairs := make([]ast.Node, 0, m.Len())
+	iter := m.MapRange()
+	for iter.Next() {
+		pairs = append(pairs, ast.NewList([]ast.Node{toValue(iter.Key()), toValue(iter.Value())}))
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].(*ast.List).Nodes[0].String() < pairs[j].(*ast.List).Nodes[0].String()
+	})
+	return ast.NewList(pairs)
+}
+
+func toErrorNode(err error) *ErrorNode {
+	if evalError, ok := err.(*EvalError); ok {
+		return NewErrorNode(evalError)
+	}
+	return NewErrorNode(NewEvalError("Evaluation error", err.Error(), nil))
+}
+
+// isNilValue reports whether a value is a nil pointer, interface, function or
+// channel. Nil slices and maps are empty rather than nil.
+func isNilValue(x reflect.Value) bool {
+	switch x.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Func, reflect.Chan:
+		return x.IsNil()
+	}
+	return false
+}
+
+////////// Vamos to Go
+
+// FromValue converts a Vamos value to the Go value it most naturally
+// corresponds to: nil, a float64, a string, a rune, a bool, an []interface{}
+// for a list, an error, or the value wrapped by a GoValue. Any other value is
+// returned as its ast.Node.
+func FromValue(n ast.Node) interface{} {
+	switch value := n.(type) {
+	case *ast.Nil:
+		return nil
+	case *ast.Number:
+		return value.Value
+	case *ast.Str:
+		return value.Value
+	case *ast.Char:
+		return value.Value
+	case *ast.Symbol:
+		switch {
+		case value.Is(trueSymbol):
+			return true
+		case value.Is(falseSymbol):
+			return false
+		}
+	case *ast.List:
+		result := make([]interface{}, len(value.Nodes))
+		for i, elem := range value.Nodes {
+			result[i] = FromValue(elem)
+		}
+		return result
+	case *ErrorNode:
+		return value.Err
+	case *GoValue:
+		return value.Value
+	}
+	return n
+}
+
+// FromValueAs converts a Vamos value to a Go value of the given type. A
+// routine converted to a function type calls the routine with the
+// interpreter when the function is called.
+func (in *Interpreter) FromValueAs(n ast.Node, t reflect.Type) (reflect.Value, error) {
+	return in.fromValueAs(nil, n, t)
+}
+
+// fromValueAs converts a value like FromValueAs for a thread subject to the
+// limits of an evaluation, if any. A routine converted to a function is called
+// subject to the same limits.
+func (in *Interpreter) fromValueAs(limits *evalLimits, n ast.Node, t reflect.Type) (reflect.Value, error) {
+	if reflect.TypeOf(n).AssignableTo(t) && t != errorType && t != anyType {
+		return reflect.ValueOf(n), nil
+	}
+	if gv, ok := n.(*GoValue); ok {
+		if gv.Value == nil {
+			// A Go value of nil converts as nil does
+			n = &ast.Nil{}
+		} else if reflect.TypeOf(gv.Value).AssignableTo(t) {
+			return reflect.ValueOf(gv.Value).Convert(t), nil
+		}
+	}
+
+	if t == errorType {
+		switch value := n.(type) {
+		case *ast.Nil:
+			return reflect.Zero(t), nil
+		case *ErrorNode:
+			return reflect.ValueOf(error(value.Err)), nil
+		}
+		return cannotConvert(n, t)
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if _, isNil := n.(*ast.Nil); isNil {
+			return reflect.Zero(t), nil
+		}
+		x := reflect.ValueOf(FromValue(n))
+		if !x.Type().AssignableTo(t) {
+			return cannotConvert(n, t)
+		}
+		return x.Convert(t), nil
+
+	case reflect.Bool:
+		if s, ok := n.(*ast.Symbol); ok {
+			switch {
+			case s.Is(trueSymbol):
+				return reflect.ValueOf(true).Convert(t), nil
+			case s.Is(falseSymbol):
+				return reflect.ValueOf(false).Convert(t), nil
+			}
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := numberValue(n)
+		if !ok || f != math.Trunc(f) {
+			break
+		}
+		x := reflect.New(t).Elem()
+		if f < math.MinInt64 || f >= math.MaxInt64 || x.OverflowInt(int64(f)) {
+			return reflect.Value{}, fmt.Errorf("Number is out of range for a Go %v: %v", t, n)
+		}
+		x.SetInt(int64(f))
+		return x, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, ok := numberValue(n)
+		if !ok || f != math.Trunc(f) {
+			break
+		}
+		x := reflect.New(t).Elem()
+		if f < 0 || f >= math.MaxUint64 || x.OverflowUint(uint64(f)) {
+			return reflect.Value{}, fmt.Errorf("Number is out of range for a Go %v: %v", t, n)
+		}
+		x.SetUint(uint64(f))
+		return x, nil
+
+	case reflect.Float32, reflect.Float64:
+		if num, ok := n.(*ast.Number); ok {
+			return reflect.ValueOf(num.Value).Convert(t), nil
+		}
+
+	case reflect.String:
+		if s, ok := n.(*ast.Str); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+
+	case reflect.Slice, reflect.Array:
+		if _, isNil := n.(*ast.Nil); isNil && t.Kind() == reflect.Slice {
+			return reflect.Zero(t), nil
+		}
+		coll, ok := n.(ast.Coll)
+		if !ok {
+			break
+		}
+		children := coll.Children()
+		var x reflect.Value
+		if t.Kind() == reflect.Slice {
+			x = reflect.MakeSlice(t, len(children), len(children))
+		} else if len(children) == t.Len() {
+			x = reflect.New(t).Elem()
+		} else {
+			return reflect.Value{}, fmt.Errorf("Expected %v elements for a Go %v: %v", t.Len(), t, n)
+		}
+		for i, child := range children {
+			elem, err := in.fromValueAs(limits, child, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			x.Index(i).Set(elem)
+		}
+		return x, nil
+
+	case reflect.Map:
+		return in.mapFromValue(limits, n, t)
+
+	case reflect.Func:
+		if _, ok := n.(Routine); ok {
+			return in.funcFromValue(limits, n, t), nil
+		}
+
+	case reflect.Pointer:
+		if _, isNil := n.(*ast.Nil); isNil {
+			return reflect.Zero(t), nil
+		}
+		elem, err := in.fromValueAs(limits, n, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		x := reflect.New(t.Elem())
+		x.Elem().Set(elem)
+		return x, nil
+	}
+
+	return cannotConvert(n, t)
+}
+
+// numberValue returns the numeric value of a number or a char.
+func numberValue(n ast.Node) (float64, bool) {
+	switch value := n.(type) {
+	case *ast.Number:
+		return value.Value, true
+	case *ast.Char:
+		return float64(value.Value), true
+	}
+	return 0, false
+}
+
+// mapFromValue converts a list of (key value) lists to a map.
+func (in *Interpreter) mapFromValue(limits *evalLimits, n ast.Node, t reflect.Type) (reflect.Value, error) {
+	if _, isNil := n.(*ast.Nil); isNil {
+		return reflect.Zero(t), nil
+	}
+	l, ok := n.(*ast.List)
+	if !ok {
+		return cannotConvert(n, t)
+	}
+
+	m := reflect.MakeMapWithSize(t, len(l.Nodes))
+	for _, child := range l.Nodes {
+		pair, ok := child.(*ast.List)
+		if !ok || len(pair.Nodes) != 2 {
+			return reflect.Value{}, fmt.Errorf("Expected a list of (key value) lists for a Go %v: %v", t, n)
+		}
+		key, err := in.fromValueAs(limits, pair.Nodes[0], t.Key())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		value, err := in.fromValueAs(limits, pair.Nodes[1], t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		m.SetMapIndex(key, value)
+	}
+	return m, nil
+}
+
+// funcFromValue makes a Go function of the given type which calls a Vamos
+// routine. If the call fails and the function has no error result to return
+// the error with, the function panics with the error.
+func (in *Interpreter) funcFromValue(limits *evalLimits, f ast.Node, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(goArgs []reflect.Value) []reflect.Value {
+		result, err := in.callRoutine(limits, f, goArgs, t)
+		if err != nil && !returnsError(t) {
+			panic(err)
+		}
+
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+		switch {
+		case err != nil:
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+		case result.IsValid():
+			out[0] = result
+		}
+		return out
+	})
+}
+
+func (in *Interpreter) callRoutine(limits *evalLimits, f ast.Node, goArgs []reflect.Value, t reflect.Type) (reflect.Value, error) {
+	args := make(ast.Nodes, 0, len(goArgs))
+	for i, x := range goArgs {
+		if t.IsVariadic() && i == len(goArgs)-1 {
+			for j := 0; j < x.Len(); j++ {
+				args = append(args, toValue(x.Index(j)))
+			}
+			break
+		}
+		args = append(args, toValue(x))
+	}
+
+	result, err := in.apply(limits, f, args)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if t.NumOut() == 0 || (t.NumOut() == 1 && returnsError(t)) {
+		return reflect.Value{}, nil
+	}
+	return in.fromValueAs(limits, result, t.Out(0))
+}
+
+func returnsError(t reflect.Type) bool {
+	return t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+}
+
+func cannotConvert(n ast.Node, t reflect.Type) (reflect.Value, error) {
+	return reflect.Value{}, fmt.Errorf("Cannot convert a Vamos %v to a Go %v: %v", n.TypeName(), t, n)
+}
+
+////////// Go functions
+
+// NewGoPrimitive makes a primitive which calls a Go function. The arguments
+// it is called with are converted to the types of the function's parameters,
+// and its result to a Vamos value. The function may return nothing, a value,
+// an error, or a value and an error. An error which is not nil is raised as a
+// Vamos error.
+func NewGoPrimitive(name string, fn interface{}) (*Primitive, error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func {
+		return nil, errors.New("Cannot make a primitive of a value which is not a function: " + name)
+	}
+	return newGoPrimitive(name, f)
+}
+
+func newGoPrimitive(name string, f reflect.Value) (*Primitive, error) {
+	if t := f.Type(); t.NumOut() > 2 || (t.NumOut() == 2 && !returnsError(t)) {
+		return nil, errors.New("Cannot make a primitive of a function with these results: " + t.String())
+	}
+
+	minArity, maxArity := goArity(f.Type())
+	return newControlPrimitive(name, minArity, maxArity,
+		func(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+			return resume(k, callGo(th, head, name, f, args))
+		}), nil
+}
+
+// goArity returns the least and the most arguments a Go function can be
+// called with, where -1 means any number.
+func goArity(t reflect.Type) (minArity int, maxArity int) {
+	if t.IsVariadic() {
+		return t.NumIn() - 1, -1
+	}
+	return t.NumIn(), t.NumIn()
+}
+
+// callGo calls a Go function with Vamos arguments, converting them to the
+// types of its parameters, and converts its result to a Vamos value.
+func callGo(th *thread, head ast.Node, name string, f reflect.Value, args []ast.Node) ast.Node {
+	t := f.Type()
+	goArgs := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		paramType := t.In(min(i, t.NumIn()-1))
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			paramType = paramType.Elem()
+		}
+		x, err := th.interp.fromValueAs(th.limits, arg, paramType)
+		if err != nil {
+			panicEvalError(head, fmt.Sprintf("Argument %v to '%v': %v", i+1, name, err))
+		}
+		goArgs[i] = x
+	}
+
+	out := f.Call(goArgs)
+	if returnsError(t) {
+		if err := out[len(out)-1]; !err.IsNil() {
+			raiseGoError(head, err.Interface().(error))
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return &ast.Nil{}
+	}
+	return toValue(out[0])
+}
+
+// raiseGoError raises an error returned by a Go function as a Vamos error.
+func raiseGoError(head ast.Node, err error) {
+	if evalError, ok := err.(*EvalError); ok {
+		panic(evalError)
+	}
+	panicEvalError(head, err.Error())
+}
+
+////////// Primitives
+
+func primGoCall(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	receiver := reflect.ValueOf(toGoValue(args[0]).Value)
+	name := toNameValue(args[1])
+
+	var method reflect.Value
+	if receiver.IsValid() {
+		method = receiver.MethodByName(name)
+	}
+	if !method.IsValid() {
+		panicEvalError(head, fmt.Sprintf("Go value of type %v has no method: %v", goTypeName(receiver), name))
+	}
+
+	minArity, maxArity := goArity(method.Type())
+	checkBuiltinArgs("Go method", name, head, args[2:], minArity, maxArity)
+	return resume(k, callGo(th, head, name, method, args[2:]))
+}
+
+func primGoField(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	x := reflect.ValueOf(toGoValue(args[0]).Value)
+	name := toNameValue(args[1])
+
+	for x.Kind() == reflect.Pointer && !x.IsNil() {
+		x = x.Elem()
+	}
+	if x.Kind() != reflect.Struct {
+		panicEvalError(head, fmt.Sprintf("Go value of type %v is not a struct", goTypeName(x)))
+	}
+
+	field, ok := x.Type().FieldByName(name)
+	if !ok || !field.IsExported() {
+		panicEvalError(head, fmt.Sprintf("Go value of type %v has no exported field: %v", x.Type(), name))
+	}
+	return toValue(x.FieldByIndex(field.Index))
+}
+
+// primGoType returns the name of the Go type a value is converted to when it
+// is passed to Go without a type to convert it to.
+func primGoType(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	return ast.NewStr(goTypeName(reflect.ValueOf(FromValue(args[0]))))
+}
+
+// goTypeName returns the name of the type of a Go value, or "nil" for the
+// invalid value which reflect gives for nil.
+func goTypeName(x reflect.Value) string {
+	if !x.IsValid() {
+		return "nil"
+	}
+	return x.Type().String()
+}
@@ -0,0 +1,126 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+////////// Interpreter
+
+// An Interpreter evaluates Vamos code in a top-level environment of its own,
+// writing output to its own writer and reading input from its own source.
+// Interpreters share no state, so any number of them may be used in the same
+// process at once.
+type Interpreter struct {
+	// Engine is the engine the interpreter evaluates with. It should only be
+	// changed while nothing is being evaluated.
+	Engine Engine
+
+	env      *MapEnv
+	writer   io.Writer
+	readLine func() string
+
+	channelCount atomic.Int64 // How many channels have been created, for numbering them
+	gensymCount  atomic.Int64 // How many symbols 'gensym' has created, for naming them
+}
+
+// New creates an interpreter with a new top-level environment, which writes
+// output to w and reads lines of input with readLine.
+func New(w io.Writer, readLine func() string) *Interpreter {
+	return &Interpreter{
+		env:      NewTopLevelMapEnv(),
+		writer:   w,
+		readLine: readLine,
+	}
+}
+
+// Env returns the top-level environment of the interpreter.
+func (in *Interpreter) Env() Env {
+	return in.env
+}
+
+// Eval evaluates a node in the top-level environment.
+func (in *Interpreter) Eval(n ast.Node) (result ast.Node, err error) {
+	return in.EvalContext(context.Background(), n, Limits{})
+}
+
+// EvalContext evaluates a node in the top-level environment like Eval, but
+// stops with an InterruptError as soon as the context is done or one of the
+// limits is exceeded. Lazy sequences and generators created by the evaluation,
+// and routines called by Go code it calls, are subject to the same limits while
+// it is in progress. Threads started with 'go' are subject only to the limit on
+// depth.
+func (in *Interpreter) EvalContext(ctx context.Context, n ast.Node, limits Limits) (result ast.Node, err error) {
+	return in.evalIn(ctx, in.env, n, limits)
+}
+
+func (in *Interpreter) evalIn(ctx context.Context, e Env, n ast.Node, limits Limits) (result ast.Node, err error) {
+	return in.runLimited(ctx, limits, func(th *thread) packet {
+		return evalTopLevel(th, e, n, endContinuation)
+	})
+}
+
+// Apply calls a routine, such as a procedure defined by Vamos code, with
+// arguments which are already values.
+func (in *Interpreter) Apply(f ast.Node, args ast.Nodes) (result ast.Node, err error) {
+	return in.apply(nil, f, args)
+}
+
+// apply calls a routine like Apply, subject to the limits of an evaluation, if
+// any.
+func (in *Interpreter) apply(limits *evalLimits, f ast.Node, args ast.Nodes) (result ast.Node, err error) {
+	r, ok := f.(Routine)
+	if !ok {
+		return nil, errors.New("Not a routine: " + f.String())
+	}
+	head := ast.Intern(r.RoutineName())
+	return in.runWithin(limits, func(th *thread) packet {
+		return applyRoutine(th, in.env, r, head, args, endContinuation)
+	})
+}
+
+// Define gives a name a value in the top-level environment, unless the name
+// already has one.
+func (in *Interpreter) Define(name string, value ast.Node) error {
+	symbol := ast.Intern(name)
+	if _, exists := in.env.Get(symbol); exists {
+		return errors.New("Cannot redefine a name: " + name)
+	}
+	in.env.Set(symbol, value)
+	return nil
+}
+
+// Eval evaluates a node in an environment, such as one created by
+// NewTopLevelMapEnv, writing output to w and reading lines of input with rl.
+//
+// Deprecated: Use New and Interpreter.Eval. Each call evaluates with an
+// interpreter of its own, so channels and generated symbols are numbered
+// afresh each time.
+func Eval(e Env, n ast.Node, w io.Writer, rl func() string) (result ast.Node, err error) {
+	return EvalContext(context.Background(), e, n, w, rl, Limits{})
+}
+
+// EvalContext evaluates a node in an environment like Eval, but stops with an
+// InterruptError as soon as the context is done or one of the limits is
+// exceeded.
+//
+// Deprecated: Use New and Interpreter.EvalContext.
+func EvalContext(ctx context.Context, e Env, n ast.Node, w io.Writer, rl func() string, limits Limits) (result ast.Node, err error) {
+	return newForEnv(w, rl).evalIn(ctx, e, n, limits)
+}
+
+// newForEnv creates an interpreter for the package-level functions, which
+// evaluate in an environment given by the caller rather than one of the
+// interpreter's own.
+func newForEnv(w io.Writer, readLine func() string) *Interpreter {
+	return &Interpreter{writer: w, readLine: readLine}
+}
+
+// nextChannelNumber returns the number of the next channel to be created.
+func (in *Interpreter) nextChannelNumber() int {
+	return int(in.channelCount.Add(1) - 1)
+}
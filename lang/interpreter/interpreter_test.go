@@ -0,0 +1,129 @@
+package interpreter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+func parseEvalAll(in *Interpreter, input string) string {
+	nodes, _ := parser.Parse(input, "interpreter.v")
+
+	result := ""
+	for _, n := range nodes {
+		value, err := in.Eval(n)
+		if err != nil {
+			return err.Error()
+		}
+		result = value.String()
+	}
+	return result
+}
+
+func TestInterpreter_Isolated(t *testing.T) {
+	var out1, out2 bytes.Buffer
+	in1 := New(&out1, func() string { return "one" })
+	in2 := New(&out2, func() string { return "two" })
+
+	const program = `
+(def x (read-line))
+(println x (chan) (chan))
+(gensym)`
+
+	var wg sync.WaitGroup
+	results := make([]string, 2)
+	for i, in := range []*Interpreter{in1, in2} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = parseEvalAll(in, program)
+		}()
+	}
+	wg.Wait()
+
+	// Each interpreter has its own output, input, environment and counters
+	testhelp.CheckEqualString(t, "one #chan<0> #chan<1>\n", out1.String())
+	testhelp.CheckEqualString(t, "two #chan<0> #chan<1>\n", out2.String())
+	testhelp.CheckEqualString(t, "G#1", results[0])
+	testhelp.CheckEqualString(t, "G#1", results[1])
+}
+
+func TestInterpreter_PrintErrorWritesToItsWriter(t *testing.T) {
+	var out bytes.Buffer
+	in := New(&out, func() string { return "" })
+
+	_, err := in.ParseEval("(def f (proc () (first 1)))\n(f)", "interpreter.v")
+	in.PrintError(err)
+
+	testhelp.CheckEqualString(t, `Evaluation error (interpreter.v: 1): Cannot get first from a non-collection: 1
+Traceback (innermost first):
+  in f (interpreter.v: 2:2) called with ()
+`, out.String())
+}
+
+func TestEval_InGivenEnv(t *testing.T) {
+	var out bytes.Buffer
+	env := NewTopLevelMapEnv()
+	nodes, _ := parser.Parse(`(def x (read-line)) (println x) x`, "interpreter.v")
+
+	var value ast.Node
+	for _, n := range nodes {
+		var err error
+		if value, err = Eval(env, n, &out, func() string { return "line" }); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	testhelp.CheckEqualString(t, "line\n", out.String())
+	testhelp.CheckEqualString(t, `"line"`, value.String())
+	if _, ok := env.Get(ast.Intern("x")); !ok {
+		t.Errorf("Expected x to be defined in the given environment")
+	}
+}
+
+func TestInterpreter_SymbolsAreInterned(t *testing.T) {
+	in := New(&bytes.Buffer{}, func() string { return "" })
+	nodes, _ := parser.Parse("(typeof 1) (= 'number (typeof 2))", "interpreter.v")
+
+	value, _ := in.Eval(nodes[0])
+	if value != ast.Intern("number") {
+		t.Errorf("Expected typeof to return the interned symbol, got <%v>", value)
+	}
+	value, _ = in.Eval(nodes[1])
+	if value != trueSymbol {
+		t.Errorf("Expected true, got <%v>", value)
+	}
+}
+
+func TestEvalMacroCall_ExpansionPreparedForEngine(t *testing.T) {
+	in := New(&bytes.Buffer{}, func() string { return "" })
+	parseEvalAll(in, `(def twice (macro (proc (x) (list '+ x x))))`)
+	nodes, _ := parser.Parse(`(twice 2)`, "interpreter.v")
+	call := nodes[0].(*ast.List)
+
+	for _, engine := range []Engine{ClosureCompiler, ClosureCompiler, BytecodeVM, TreeWalker} {
+		in.Engine = engine
+		result, err := in.Eval(call)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		testhelp.CheckEqualString(t, "4", result.String())
+
+		if prepared := call.Expansion().Prepared.(*preparedForm); prepared.engine != engine {
+			t.Errorf("Expected the expansion to be prepared for engine %v but got %v", engine, prepared.engine)
+		}
+	}
+}
+
+func TestIntern_GeneratedNamesNotInterned(t *testing.T) {
+	if ast.Intern("x#1") == ast.Intern("x#1") {
+		t.Errorf("Expected a name containing '#' not to be interned")
+	}
+
+	in := New(&bytes.Buffer{}, func() string { return "" })
+	testhelp.CheckEqualString(t, "false", parseEvalAll(in, `(= (gensym "x") (gensym "x"))`))
+}
@@ -0,0 +1,196 @@
+package interpreter
+
+import (
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/token"
+)
+
+////////// Promises
+
+// specialDelay creates a promise to evaluate an expression when it is forced.
+func specialDelay(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	return resume(k, &Promise{Env: e, Expr: args[0]})
+}
+
+// primForce evaluates the expression of a promise the first time it is
+// forced, and returns the same value every time after that. Forcing any other
+// value returns it unchanged.
+func primForce(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	p, ok := args[0].(*Promise)
+	if !ok {
+		return resume(k, args[0])
+	}
+
+	if value := p.forcedValue(); value != nil {
+		return resume(k, value)
+	}
+
+	return evalNode(th, p.Env, p.Expr, then(th, func(th *thread, value ast.Node) packet {
+		return resume(k, p.fulfill(value))
+	}))
+}
+
+////////// Lazy Sequences
+
+// evalNested evaluates to completion in a thread of its own of the
+// interpreter, which takes its dynamic bindings and limits from the origin. It
+// is used where Go code needs the value of Vamos code straight away, such as
+// when a lazy sequence is realized by 'first'. An error raised by the
+// evaluation, or an interruption, escapes to the caller. The evaluation starts
+// in the form of the origin, which created the Go code, so that errors raised
+// at symbols in the form are located there.
+func evalNested(o origin, start func(*thread) packet) ast.Node {
+	th := newThread(o.interp)
+	th.bindings, th.form = o.bindings, o.form
+	if o.limits != nil {
+		o.limits.apply(th)
+	}
+
+	// The nested thread carries on from the depth of the thread which created
+	// the Go code, so that recursion through lazy sequences is limited like
+	// recursion through procedures
+	th.baseDepth = o.depth + 1
+	if th.maxDepth >= 0 && th.baseDepth > th.maxDepth {
+		var loc *token.Location
+		if o.form != nil {
+			loc = o.form.Location
+		}
+		panic(NewEvalError("Evaluation error", depthExceededMessage(th), loc))
+	}
+	return trampoline(th, func() packet {
+		return start(th)
+	})
+}
+
+// specialLazySeq creates a lazy sequence, which is produced by evaluating the
+// body forms the first time it is needed. The body is evaluated with the
+// dynamic bindings in place where the sequence was created, and should
+// produce a collection, typically a cons onto another lazy sequence.
+func specialLazySeq(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	o := originOf(th)
+
+	return resume(k, ast.NewLazySeq(func() ast.Coll {
+		value := evalNested(o, func(th *thread) packet {
+			return evalSequence(th, e, args, endContinuation)
+		})
+
+		coll, ok := value.(ast.Coll)
+		if !ok {
+			panic(NewEvalError("Evaluation error", "Body of 'lazy-seq' should produce a collection but got: "+value.String(), locate(head, o.form)))
+		}
+		return coll
+	}))
+}
+
+// lazyCons creates a sequence of a first element and a lazily produced rest.
+func lazyCons(first ast.Node, rest func() ast.Coll) ast.Coll {
+	result, _ := ast.NewLazySeq(rest).Cons(first)
+	return result
+}
+
+// primIterate returns the infinite sequence x, (f x), (f (f x)), ...
+func primIterate(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	f := toRoutineValue(args[0])
+	o := originOf(th)
+
+	var iterate func(x ast.Node) ast.Coll
+	iterate = func(x ast.Node) ast.Coll {
+		return lazyCons(x, func() ast.Coll {
+			next := evalNested(o, func(th *thread) packet {
+				return applyRoutine(th, e, f, head, ast.Nodes{x}, endContinuation)
+			})
+			return iterate(next)
+		})
+	}
+
+	return resume(k, iterate(args[1]))
+}
+
+// primLazyMap returns the sequence of the results of applying a routine to
+// each element of a collection, which are computed as they are needed.
+func primLazyMap(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	f := toRoutineValue(args[0])
+	o := originOf(th)
+
+	var lazyMap func(coll ast.Coll) ast.Coll
+	lazyMap = func(coll ast.Coll) ast.Coll {
+		return ast.NewLazySeq(func() ast.Coll {
+			if coll.IsEmpty() {
+				return &ast.Nil{}
+			}
+			value := evalNested(o, func(th *thread) packet {
+				return applyRoutine(th, e, f, head, ast.Nodes{coll.First()}, endContinuation)
+			})
+			return lazyCons(value, func() ast.Coll {
+				return lazyMap(coll.Rest().(ast.Coll))
+			})
+		})
+	}
+
+	return resume(k, lazyMap(toCollValue(args[1])))
+}
+
+// primRange returns a lazy sequence of numbers from start, which defaults to
+// 0, up to but not including end, in increments of step, which defaults to 1.
+// Without an end, the sequence is infinite.
+func primRange(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	start, end, step := 0.0, 0.0, 1.0
+	bounded := len(args) > 0
+
+	switch len(args) {
+	case 1:
+		end = toNumberValue(args[0])
+	case 2, 3:
+		start = toNumberValue(args[0])
+		end = toNumberValue(args[1])
+		if len(args) == 3 {
+			step = toNumberValue(args[2])
+		}
+	}
+
+	var numbersFrom func(x float64) ast.Coll
+	numbersFrom = func(x float64) ast.Coll {
+		if bounded && ((step >= 0 && x >= end) || (step < 0 && x <= end)) {
+			return &ast.Nil{}
+		}
+		return lazyCons(&ast.Number{Value: x}, func() ast.Coll {
+			return numbersFrom(x + step)
+		})
+	}
+
+	return ast.NewLazySeq(func() ast.Coll {
+		return numbersFrom(start)
+	})
+}
+
+// primTake returns a lazy sequence of the first n elements of a collection.
+func primTake(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	var take func(n int, coll ast.Coll) ast.Coll
+	take = func(n int, coll ast.Coll) ast.Coll {
+		return ast.NewLazySeq(func() ast.Coll {
+			if n <= 0 || coll.IsEmpty() {
+				return &ast.Nil{}
+			}
+			return lazyCons(coll.First(), func() ast.Coll {
+				return take(n-1, coll.Rest().(ast.Coll))
+			})
+		})
+	}
+
+	return take(int(toNumberValue(args[0])), toCollValue(args[1]))
+}
+
+// primDrop returns a lazy sequence of the elements of a collection after the
+// first n.
+func primDrop(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	n := int(toNumberValue(args[0]))
+	coll := toCollValue(args[1])
+
+	return ast.NewLazySeq(func() ast.Coll {
+		rest := coll
+		for i := 0; i < n && !rest.IsEmpty(); i++ {
+			rest = rest.Rest().(ast.Coll)
+		}
+		return rest
+	})
+}
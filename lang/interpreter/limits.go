@@ -0,0 +1,110 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+////////// Limits
+
+// DefaultMaxDepth is the most procedure calls which may be in progress at once
+// in an evaluation which does not set a limit of its own. A lazy sequence
+// realized within another takes a few kilobytes of the Go stack, so this many
+// take a few tens of megabytes, well short of the gigabyte Go allows. Programs
+// which recurse deeper can raise the limit with Limits.MaxDepth.
+const DefaultMaxDepth = 10000
+
+// Limits restricts how long an evaluation may run and how deep its procedure
+// calls may nest. The zero value imposes no limit on steps or time, and the
+// default limit on depth.
+type Limits struct {
+	MaxSteps int       // The most steps of the trampoline the evaluation may take, or 0 for no limit
+	Deadline time.Time // When the evaluation must have finished by, or the zero time for no deadline
+	MaxDepth int       // The most procedure calls which may be in progress at once, 0 for DefaultMaxDepth, or negative for no limit
+}
+
+// ErrStepLimitExceeded is the cause of an InterruptError for an evaluation
+// which took more steps than its limit allowed.
+var ErrStepLimitExceeded = errors.New("step limit exceeded")
+
+// InterruptError is returned when an evaluation is stopped before it has
+// finished, because its context was cancelled or it exceeded one of its
+// limits. Unlike an EvalError, it cannot be caught by Vamos code.
+type InterruptError struct {
+	Cause error // context.Canceled, context.DeadlineExceeded or ErrStepLimitExceeded
+}
+
+func (e *InterruptError) Error() string {
+	return "Evaluation interrupted: " + e.Cause.Error()
+}
+
+// Unwrap returns the cause, so that errors.Is(err, context.Canceled) and the
+// like can be used to tell why the evaluation was stopped.
+func (e *InterruptError) Unwrap() error {
+	return e.Cause
+}
+
+// evalLimits are the limits of an evaluation. They apply to the threads which
+// run on its behalf: those which realize the lazy sequences and generators it
+// creates, and those which run routines for the Go code it calls. The threads
+// count their steps together, so the limit on steps is on the evaluation as a
+// whole. The limits on steps and time no longer apply to threads started once
+// the evaluation has finished.
+type evalLimits struct {
+	limiter  *limiter // What stops the threads, or nil if neither steps nor time are limited
+	maxDepth int
+	finished atomic.Bool
+}
+
+// apply subjects a new thread to the limits.
+func (l *evalLimits) apply(th *thread) {
+	th.limits = l
+	if !l.finished.Load() {
+		th.limiter = l.limiter
+	}
+	th.maxDepth = l.maxDepth
+}
+
+// limiterCheckInterval is how many steps a limiter takes between checks of
+// its context, which are slower than counting.
+const limiterCheckInterval = 1024
+
+// A limiter counts the steps the threads of an evaluation take, and stops
+// them when its context is done or they have taken too many.
+type limiter struct {
+	ctx      context.Context
+	maxSteps int64
+	steps    atomic.Int64
+}
+
+// done returns a channel which is closed when the thread should stop, for
+// primitives which wait, or nil if the thread need never stop.
+func (th *thread) done() <-chan struct{} {
+	if th.limiter == nil {
+		return nil
+	}
+	return th.limiter.ctx.Done()
+}
+
+// interrupt panics with an InterruptError for a thread whose context is done.
+func (th *thread) interrupt() {
+	panic(&InterruptError{Cause: th.limiter.ctx.Err()})
+}
+
+// step counts a step of the trampoline, panicking with an InterruptError if
+// the thread should stop.
+func (l *limiter) step() {
+	steps := l.steps.Add(1)
+
+	if l.maxSteps > 0 && steps > l.maxSteps {
+		panic(&InterruptError{Cause: ErrStepLimitExceeded})
+	}
+
+	if steps%limiterCheckInterval == 0 {
+		if err := l.ctx.Err(); err != nil {
+			panic(&InterruptError{Cause: err})
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package interpreter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+const infiniteLoop = `
+(def loop (proc (i) (loop (+ i 1))))
+(try
+  (loop 0)
+  (catch e 'caught))`
+
+func evalLimited(ctx context.Context, input string, limits Limits) (ast.Node, error) {
+	nodes, _ := parser.Parse(input, "limits.v")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+
+	var result ast.Node
+	var err error
+	for _, n := range nodes {
+		if result, err = in.EvalContext(ctx, n, limits); err != nil {
+			break
+		}
+	}
+	return result, err
+}
+
+func checkInterrupted(t *testing.T, err error, cause error) {
+	var interruptErr *InterruptError
+	if !errors.As(err, &interruptErr) {
+		t.Fatalf("Expected an InterruptError, got <%v>", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Fatalf("Expected the evaluation to be interrupted by <%v>, got <%v>", cause, err)
+	}
+}
+
+func TestEvalContext_WithinLimits(t *testing.T) {
+	result, err := evalLimited(context.Background(), "(+ 1 2)", Limits{MaxSteps: 1000, Deadline: time.Now().Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "3", result.String())
+}
+
+func TestEvalContext_StepLimit(t *testing.T) {
+	_, err := evalLimited(context.Background(), infiniteLoop, Limits{MaxSteps: 100000})
+	checkInterrupted(t, err, ErrStepLimitExceeded)
+	testhelp.CheckEqualString(t, "Evaluation interrupted: step limit exceeded", err.Error())
+}
+
+func TestEvalContext_Deadline(t *testing.T) {
+	_, err := evalLimited(context.Background(), infiniteLoop, Limits{Deadline: time.Now().Add(50 * time.Millisecond)})
+	checkInterrupted(t, err, context.DeadlineExceeded)
+}
+
+func TestEvalContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := evalLimited(ctx, infiniteLoop, Limits{})
+	checkInterrupted(t, err, context.Canceled)
+}
+
+func TestEvalContext_EnvironmentSurvivesInterruption(t *testing.T) {
+	nodes, _ := parser.Parse(`(def x 42) (def loop (proc () (loop))) (loop) x`, "limits.v")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+
+	for _, n := range nodes[:3] {
+		_, err := in.EvalContext(context.Background(), n, Limits{MaxSteps: 10000})
+		if n == nodes[2] {
+			checkInterrupted(t, err, ErrStepLimitExceeded)
+		}
+	}
+
+	result, err := in.Eval(nodes[3])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "42", result.String())
+}
+
+const deepRecursion = `
+(def deep (proc (n) (if (= n 0) 0 (+ 1 (deep (- n 1))))))
+(deep 20000)`
+
+func TestEvalContext_MaxDepth(t *testing.T) {
+	_, err := evalLimited(context.Background(), deepRecursion, Limits{MaxDepth: 50})
+
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		t.Fatalf("Expected an EvalError, got <%v>", err)
+	}
+	testhelp.CheckEqualString(t, "Stack depth exceeded: more than 50 procedure calls in progress", evalErr.Message)
+	testhelp.CheckEqualInt(t, 51, len(evalErr.Frames()))
+	testhelp.CheckEqualString(t, "(19950)", evalErr.Frames()[0].Arguments)
+}
+
+func TestEvalContext_DefaultMaxDepth(t *testing.T) {
+	result, err := evalLimited(context.Background(), `
+(def deep (proc (n) (if (= n 0) 0 (+ 1 (deep (- n 1))))))
+(deep 9000)`, Limits{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "9000", result.String())
+
+	_, err = evalLimited(context.Background(), deepRecursion, Limits{})
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		t.Fatalf("Expected an *EvalError but got <%#v>", err)
+	}
+	testhelp.CheckEqualString(t, "Stack depth exceeded: more than 10000 procedure calls in progress", evalErr.Message)
+}
+
+func TestEvalContext_NoMaxDepth(t *testing.T) {
+	result, err := evalLimited(context.Background(), deepRecursion, Limits{MaxDepth: -1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "20000", result.String())
+}
+
+const infiniteGenerator = `
+(def spin (proc () (spin)))
+(first (generator (spin)))`
+
+func TestEvalContext_StepLimitInGenerator(t *testing.T) {
+	_, err := evalLimited(context.Background(), infiniteGenerator, Limits{MaxSteps: 100000})
+	checkInterrupted(t, err, ErrStepLimitExceeded)
+}
+
+func TestEvalContext_CancelledInLazySeq(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := evalLimited(ctx, `(def spin (proc () (spin))) (first (lazy-seq (spin)))`, Limits{})
+	checkInterrupted(t, err, context.Canceled)
+}
+
+func TestEvalContext_LazySeqRealizedInLaterEvaluation(t *testing.T) {
+	nodes, _ := parser.Parse(`(def xs (lazy-seq (cons 1 nil))) (first xs)`, "limits.v")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+
+	// The limits of the evaluation which created the sequence no longer apply
+	// once it has finished
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := in.EvalContext(ctx, nodes[0], Limits{MaxSteps: 100}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	cancel()
+
+	result, err := in.Eval(nodes[1])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "1", result.String())
+}
+
+func TestEvalContext_StepLimitAcrossLazySeqs(t *testing.T) {
+	// Each element takes far fewer steps than the limit, but all of them
+	// together take far more
+	_, err := evalLimited(context.Background(), `
+(def count-down (proc (n) (if (= n 0) 0 (count-down (- n 1)))))
+(len (lazy-map (proc (x) (count-down 100)) (range 1000)))`, Limits{MaxSteps: 20000})
+	checkInterrupted(t, err, ErrStepLimitExceeded)
+}
+
+func TestEvalContext_Overlapping(t *testing.T) {
+	var out bytes.Buffer
+	in := New(&out, func() string { return "" })
+
+	aStarted, bStarted, aDone := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	define := func(name string, fn func()) {
+		p, _ := NewGoPrimitive(name, fn)
+		in.Define(name, p)
+	}
+	define("a", func() { close(aStarted); <-bStarted })
+	define("b", func() { close(bStarted); <-aDone })
+	nodes, _ := parser.Parse(`(a) (b) (def loop (proc (n) (if (= n 0) 'done (loop (- n 1))))) loop`, "limits.v")
+
+	// The evaluation which starts first finishes first, and its context is
+	// cancelled once it has
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		in.EvalContext(ctx, nodes[0], Limits{})
+		cancel()
+		close(aDone)
+	}()
+	<-aStarted
+	if _, err := in.Eval(nodes[1]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Neither evaluation's limits apply to what is evaluated afterwards
+	in.Eval(nodes[2])
+	f, _ := in.Eval(nodes[3])
+	result, err := in.Apply(f, ast.Nodes{&ast.Number{Value: 10000}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "done", result.String())
+}
+
+func TestEvalContext_CancelledWhileWaiting(t *testing.T) {
+	for _, input := range []string{`(take! (chan))`, `(send! (chan) 1)`, `(sleep 1000000)`} {
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		_, err := evalLimited(ctx, input, Limits{})
+		checkInterrupted(t, err, context.Canceled)
+	}
+}
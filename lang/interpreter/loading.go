@@ -1,7 +1,9 @@
 package interpreter
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/onlyafly/vamos/lang/ast"
@@ -9,23 +11,86 @@ import (
 )
 
 // ParseEvalPrint parses, evals, and prints
+func (in *Interpreter) ParseEvalPrint(input string, sourceName string, printResult bool) {
+	in.parseEvalPrint(in.env, input, sourceName, printResult)
+}
+
+// ParseEvalPrint parses, evals, and prints in an environment, such as one
+// created by NewTopLevelMapEnv, writing to standard output.
+//
+// Deprecated: Use New and Interpreter.ParseEvalPrint.
 func ParseEvalPrint(env Env, input string, readLine func() string, sourceName string, printResult bool) {
-	if result, err := ParseEval(env, input, readLine, sourceName); err == nil {
+	newForEnv(os.Stdout, readLine).parseEvalPrint(env, input, sourceName, printResult)
+}
+
+func (in *Interpreter) parseEvalPrint(env Env, input string, sourceName string, printResult bool) {
+	if result, err := in.parseEvalContext(context.Background(), env, input, sourceName, Limits{}); err == nil {
 		// Can be null if nothing was entered
 		if result != nil && printResult {
-			fmt.Println(result.String())
+			fmt.Fprintln(in.writer, result.String())
 		}
 	} else {
-		fmt.Println(err.Error())
+		printError(in.writer, err)
+	}
+}
+
+// PrintError prints an error to the writer of the interpreter, followed by the
+// procedure calls which were in progress when it was raised, if any.
+func (in *Interpreter) PrintError(err error) {
+	printError(in.writer, err)
+}
+
+// PrintError prints an error to standard output like Interpreter.PrintError.
+//
+// Deprecated: Use Interpreter.PrintError, which writes to the writer of the
+// interpreter.
+func PrintError(err error) {
+	printError(os.Stdout, err)
+}
+
+func printError(w io.Writer, err error) {
+	fmt.Fprintln(w, err.Error())
+
+	if evalErr, ok := err.(*EvalError); ok && len(evalErr.Frames()) > 0 {
+		fmt.Fprintln(w, "Traceback (innermost first):")
+		fmt.Fprintln(w, evalErr.Traceback())
 	}
 }
 
 // ParseEval parses and evals
+func (in *Interpreter) ParseEval(input string, sourceName string) (ast.Node, error) {
+	return in.ParseEvalContext(context.Background(), input, sourceName, Limits{})
+}
+
+// ParseEvalContext parses and evals like ParseEval, but stops with an
+// InterruptError as soon as the context is done or one of the limits is
+// exceeded. The limits apply to each top-level form separately.
+func (in *Interpreter) ParseEvalContext(ctx context.Context, input string, sourceName string, limits Limits) (ast.Node, error) {
+	return in.parseEvalContext(ctx, in.env, input, sourceName, limits)
+}
+
+// ParseEval parses and evals in an environment, such as one created by
+// NewTopLevelMapEnv, writing to standard output.
+//
+// Deprecated: Use New and Interpreter.ParseEval.
 func ParseEval(env Env, input string, readLine func() string, sourceName string) (ast.Node, error) {
+	return ParseEvalContext(context.Background(), env, input, readLine, sourceName, Limits{})
+}
+
+// ParseEvalContext parses and evals in an environment like ParseEval, but
+// stops with an InterruptError as soon as the context is done or one of the
+// limits is exceeded.
+//
+// Deprecated: Use New and Interpreter.ParseEvalContext.
+func ParseEvalContext(ctx context.Context, env Env, input string, readLine func() string, sourceName string, limits Limits) (ast.Node, error) {
+	return newForEnv(os.Stdout, readLine).parseEvalContext(ctx, env, input, sourceName, limits)
+}
+
+func (in *Interpreter) parseEvalContext(ctx context.Context, env Env, input string, sourceName string, limits Limits) (ast.Node, error) {
 	defer func() {
 		// Some non-application triggered panic has occurred
 		if e := recover(); e != nil {
-			fmt.Printf("Host environment error: %v\n", e)
+			fmt.Fprintf(in.writer, "Host environment error: %v\n", e)
 			panic(e)
 		}
 	}()
@@ -33,13 +98,13 @@ func ParseEval(env Env, input string, readLine func() string, sourceName string)
 	nodes, parseErrors := parser.Parse(input, sourceName)
 
 	if parseErrors != nil {
-		fmt.Println(parseErrors.String())
+		fmt.Fprintln(in.writer, parseErrors.String())
 	}
 
 	var result ast.Node
 	var evalError error
 	for _, n := range nodes {
-		result, evalError = Eval(env, n, os.Stdout, readLine)
+		result, evalError = in.evalIn(ctx, env, n, limits)
 		if evalError != nil {
 			break
 		}
@@ -0,0 +1,176 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Match
+
+// specialMatch evaluates its first argument, then tries the patterns of the
+// clauses which follow, given as pairs of a pattern and a body, in order. The
+// body of the first clause whose pattern matches is evaluated in a new
+// environment in which the variables of the pattern are bound.
+//
+// Patterns are:
+//
+//	_                  matches anything
+//	name               matches anything, binding it to name
+//	1, "s", \c, nil,
+//	true, false        match values equal to themselves
+//	'datum             matches values equal to datum
+//	(p1 p2 &rest ps)   matches lists whose elements match the patterns
+//	(? pred p)         matches values for which pred returns true, and which
+//	                   match the optional pattern p
+//	(when p guard)     matches values which match p, if guard then evaluates
+//	                   to true
+func specialMatch(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	clauses := args[1:]
+	if len(clauses)%2 != 0 {
+		panicEvalError(head, "Expected pairs of patterns and bodies in 'match': "+ast.Nodes(clauses).String())
+	}
+
+	return evalNode(th, e, args[0], then(th, func(th *thread, value ast.Node) packet {
+		return evalMatchClause(th, e, head, value, clauses, k)
+	}))
+}
+
+func evalMatchClause(th *thread, e Env, head ast.Node, value ast.Node, clauses []ast.Node, k *continuation) packet {
+	if len(clauses) == 0 {
+		panicEvalError(head, "No matching match clause for value: "+value.String())
+		return respond(&ast.Nil{})
+	}
+
+	clauseEnv := NewMapEnv("match", e)
+	return matchPattern(th, clauseEnv, clauses[0], value, func(th *thread, matched bool) packet {
+		if matched {
+			return bounce(func() packet {
+				return evalNode(th, clauseEnv, clauses[1], k)
+			})
+		}
+		return bounce(func() packet {
+			return evalMatchClause(th, e, head, value, clauses[2:], k)
+		})
+	})
+}
+
+// matchPattern matches a value against a pattern, binding the variables of
+// the pattern in e, and passes whether it matched to k.
+func matchPattern(th *thread, e *MapEnv, pattern ast.Node, value ast.Node, k func(*thread, bool) packet) packet {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		switch p.Base().Name {
+		case "_":
+			return k(th, true)
+		case "true", "false":
+			return k(th, literalMatches(p.Base(), value))
+		}
+		if _, exists := e.symbols[p.Interned()]; exists {
+			panicEvalError(p, "Variable bound more than once in a pattern: "+p.Name)
+		}
+		e.Set(p, value)
+		return k(th, true)
+	case *ast.List:
+		if len(p.Nodes) > 0 {
+			switch {
+			case isKeyword(p.Nodes[0], "quote"):
+				checkPatternForm(p, "'quote' pattern should be of the form 'datum", 2, 2)
+				return k(th, literalMatches(stripAliases(p.Nodes[1]), value))
+			case isKeyword(p.Nodes[0], "?"):
+				checkPatternForm(p, "Predicate pattern should be of the form (? pred pattern)", 2, 3)
+				return matchPredicate(th, e, p, value, k)
+			case isKeyword(p.Nodes[0], "when"):
+				checkPatternForm(p, "Guard pattern should be of the form (when pattern guard)", 3, 3)
+				return matchPattern(th, e, p.Nodes[1], value, func(th *thread, matched bool) packet {
+					if !matched {
+						return k(th, false)
+					}
+					return evalNode(th, e, p.Nodes[2], then(th, func(th *thread, guard ast.Node) packet {
+						return k(th, toBooleanValue(guard))
+					}))
+				})
+			}
+		}
+
+		switch val := value.(type) {
+		case *ast.List:
+			return matchElements(th, e, p.Nodes, val.Nodes, k)
+		case *ast.Nil:
+			return matchElements(th, e, p.Nodes, nil, k)
+		}
+		return k(th, false)
+	}
+
+	return k(th, literalMatches(pattern, value))
+}
+
+// matchPredicate matches a (? pred pattern) pattern by applying the predicate
+// to the value.
+func matchPredicate(th *thread, e *MapEnv, p *ast.List, value ast.Node, k func(*thread, bool) packet) packet {
+	return evalNode(th, e, p.Nodes[1], then(th, func(th *thread, predicate ast.Node) packet {
+		r, ok := predicate.(Routine)
+		if !ok {
+			panicEvalError(p.Nodes[1], "Predicate in pattern not a routine: "+predicate.String())
+		}
+
+		return applyRoutine(th, e, r, p.Nodes[1], ast.Nodes{value}, then(th, func(th *thread, result ast.Node) packet {
+			if !toBooleanValue(result) {
+				return k(th, false)
+			}
+			if len(p.Nodes) == 2 {
+				return k(th, true)
+			}
+			return matchPattern(th, e, p.Nodes[2], value, k)
+		}))
+	}))
+}
+
+// matchElements matches the elements of a list against a list of patterns,
+// the last of which may follow '&rest' to match the remaining elements.
+func matchElements(th *thread, e *MapEnv, patterns []ast.Node, values []ast.Node, k func(*thread, bool) packet) packet {
+	if len(patterns) == 0 {
+		return k(th, len(values) == 0)
+	}
+
+	if isKeyword(patterns[0], "&rest") {
+		if len(patterns) != 2 {
+			panicEvalError(patterns[0], "'&rest' should be followed by exactly one pattern: "+ast.Nodes(patterns).String())
+		}
+		return matchPattern(th, e, patterns[1], ast.NewList(values), k)
+	}
+
+	if len(values) == 0 {
+		return k(th, false)
+	}
+
+	return matchPattern(th, e, patterns[0], values[0], func(th *thread, matched bool) packet {
+		if !matched {
+			return k(th, false)
+		}
+		return matchElements(th, e, patterns[1:], values[1:], k)
+	})
+}
+
+// literalMatches reports whether a value is equal to a literal pattern. Values
+// of different types never match, even if 'Equals' would consider them equal.
+func literalMatches(literal ast.Node, value ast.Node) bool {
+	if literal.TypeName() != value.TypeName() {
+		return false
+	}
+	if l, ok := literal.(*ast.List); ok {
+		vl := value.(*ast.List)
+		if len(l.Nodes) != len(vl.Nodes) {
+			return false
+		}
+		for i := range l.Nodes {
+			if !literalMatches(l.Nodes[i], vl.Nodes[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return literal.Equals(value)
+}
+
+func checkPatternForm(p *ast.List, message string, minLength int, maxLength int) {
+	if len(p.Nodes) < minLength || len(p.Nodes) > maxLength {
+		panicEvalError(p, message+": "+p.String())
+	}
+}
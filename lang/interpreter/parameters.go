@@ -0,0 +1,222 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+////////// Parameter Lists
+
+// A parameterList is a procedure's parameters, divided into groups by the
+// markers '&optional', '&rest' and '&key'. They may appear in that order,
+// except that '&rest' and '&key' cannot be used together.
+type parameterList struct {
+	required []ast.Node // Patterns, which may destructure their arguments
+	optional []*defaultedParameter
+	rest     ast.Node // Pattern for the remaining arguments, or nil
+	keys     []*defaultedParameter
+
+	frameNames []*ast.Symbol // The names the parameters bind, which are the slots of a frame for a call
+}
+
+// A defaultedParameter is an optional or keyword parameter, written either as
+// a name or as a list of a name and an expression for its default value.
+type defaultedParameter struct {
+	name         *ast.Symbol
+	defaultValue ast.Node // nil if the default is nil
+}
+
+// parseParameters divides a list of parameters into its groups, panicking if
+// the list is malformed.
+func parseParameters(head ast.Node, params []ast.Node) *parameterList {
+	pl := &parameterList{}
+
+	section := "required"
+	for i := 0; i < len(params); i++ {
+		param := params[i]
+		switch {
+		case isKeyword(param, "&optional"):
+			if section != "required" {
+				panicEvalError(head, "'&optional' should come before '&rest' and '&key': "+ast.Nodes(params).String())
+			}
+			section = "&optional"
+			continue
+		case isKeyword(param, "&rest"):
+			if section == "&key" || (i+2 < len(params) && isKeyword(params[i+2], "&key")) {
+				panicEvalError(head, "'&rest' and '&key' cannot be used together: "+ast.Nodes(params).String())
+			}
+			if i != len(params)-2 {
+				panicEvalError(head, "'&rest' should be followed by exactly one parameter: "+ast.Nodes(params).String())
+			}
+			checkPattern("Procedure parameters", head, params[i+1])
+			pl.rest = params[i+1]
+			i = len(params)
+			continue
+		case isKeyword(param, "&key"):
+			if section == "&key" {
+				panicEvalError(head, "'&key' should only appear once: "+ast.Nodes(params).String())
+			}
+			section = "&key"
+			continue
+		}
+
+		switch section {
+		case "required":
+			checkPattern("Procedure parameters", head, param)
+			pl.required = append(pl.required, param)
+		case "&optional":
+			pl.optional = append(pl.optional, parseDefaultedParameter(head, param))
+		case "&key":
+			pl.keys = append(pl.keys, parseDefaultedParameter(head, param))
+		}
+	}
+
+	pl.frameNames = pl.names()
+	return pl
+}
+
+func parseDefaultedParameter(head ast.Node, param ast.Node) *defaultedParameter {
+	switch val := param.(type) {
+	case *ast.Symbol:
+		return &defaultedParameter{name: val}
+	case *ast.List:
+		if len(val.Nodes) == 2 {
+			if name, ok := val.Nodes[0].(*ast.Symbol); ok {
+				return &defaultedParameter{name: name, defaultValue: val.Nodes[1]}
+			}
+		}
+	}
+
+	panicEvalError(head, "Optional and keyword parameters should be a name or (name default): "+param.String())
+	return nil
+}
+
+// arity returns the minimum and maximum number of arguments accepted. The
+// maximum is -1 if there is no limit.
+func (pl *parameterList) arity() (int, int) {
+	minArity := len(pl.required)
+	if pl.rest != nil {
+		return minArity, -1
+	}
+	return minArity, minArity + len(pl.optional) + 2*len(pl.keys)
+}
+
+// names returns the names bound by the parameters, in order.
+func (pl *parameterList) names() []*ast.Symbol {
+	var names []*ast.Symbol
+	for _, pattern := range pl.required {
+		names = patternNames(pattern, names)
+	}
+	for _, param := range pl.optional {
+		names = append(names, param.name.Interned())
+	}
+	if pl.rest != nil {
+		names = patternNames(pl.rest, names)
+	}
+	for _, param := range pl.keys {
+		names = append(names, param.name.Interned())
+	}
+	return names
+}
+
+// bindParameters binds the parameters of a procedure to its arguments in its
+// lexical environment. Default values are evaluated in that environment, in
+// the order of the parameters, so they may refer to the parameters before
+// them.
+func bindParameters(th *thread, e Env, pl *parameterList, head ast.Node, args []ast.Node, k *continuation) packet {
+	for i, pattern := range pl.required {
+		bindPattern(e, pattern, args[i])
+	}
+	args = args[len(pl.required):]
+
+	// Optional parameters are supplied by position, and keyword parameters by
+	// name from the arguments after them
+	defaulted := append(append([]*defaultedParameter{}, pl.optional...), pl.keys...)
+	supplied := make([]ast.Node, len(defaulted))
+	for i := range pl.optional {
+		if len(args) == 0 {
+			break
+		}
+		supplied[i], args = args[0], args[1:]
+	}
+
+	if pl.rest != nil {
+		bindPattern(e, pl.rest, ast.NewList(args))
+	} else if len(pl.keys) > 0 {
+		supplyKeywordArguments(head, pl, supplied[len(pl.optional):], args)
+	}
+
+	return bindDefaultedParameters(th, e, defaulted, supplied, k)
+}
+
+// bindRequiredParameters binds the parameters of a procedure which has no
+// optional or keyword parameters to its arguments.
+func bindRequiredParameters(e Env, pl *parameterList, args []ast.Node) {
+	for i, pattern := range pl.required {
+		bindPattern(e, pattern, args[i])
+	}
+	if pl.rest != nil {
+		bindPattern(e, pl.rest, ast.NewList(args[len(pl.required):]))
+	}
+}
+
+// supplyKeywordArguments matches arguments of the form 'name value ...' to
+// the keyword parameters.
+func supplyKeywordArguments(head ast.Node, pl *parameterList, supplied []ast.Node, args []ast.Node) {
+	if len(args)%2 != 0 {
+		panicEvalError(head, "Keyword arguments should be pairs of a name and a value: "+ast.Nodes(args).String())
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		name, ok := args[i].(*ast.Symbol)
+		if !ok {
+			panicEvalError(head, "Keyword argument name should be a symbol: "+args[i].String())
+		}
+
+		found := false
+		for j, key := range pl.keys {
+			if key.name.Base().Name == name.Name {
+				if supplied[j] != nil {
+					panicEvalError(head, "Keyword argument given more than once: "+name.Name)
+				}
+				supplied[j] = args[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			panicEvalError(head, fmt.Sprintf("Unknown keyword argument: %v. Keyword parameters: %v.", name.Name, keyNames(pl.keys)))
+		}
+	}
+}
+
+func keyNames(keys []*defaultedParameter) ast.Nodes {
+	names := make(ast.Nodes, len(keys))
+	for i, key := range keys {
+		names[i] = key.name.Base()
+	}
+	return names
+}
+
+// bindDefaultedParameters binds each optional or keyword parameter to its
+// supplied argument, or else to its evaluated default value.
+func bindDefaultedParameters(th *thread, e Env, params []*defaultedParameter, supplied []ast.Node, k *continuation) packet {
+	for len(params) > 0 && (supplied[0] != nil || params[0].defaultValue == nil) {
+		var value ast.Node = &ast.Nil{}
+		if supplied[0] != nil {
+			value = supplied[0]
+		}
+		e.Set(params[0].name, value)
+		params, supplied = params[1:], supplied[1:]
+	}
+
+	if len(params) == 0 {
+		return resume(k, &ast.Nil{})
+	}
+
+	return evalNode(th, e, params[0].defaultValue, then(th, func(th *thread, value ast.Node) packet {
+		e.Set(params[0].name, value)
+		return bindDefaultedParameters(th, e, params[1:], supplied[1:], k)
+	}))
+}
@@ -14,12 +14,12 @@ import (
 
 ////////// Primitive Support
 
-var trueSymbol, falseSymbol *ast.Symbol
+var trueSymbol, falseSymbol = ast.Intern("true"), ast.Intern("false")
 
 func initializePrimitives(e Env) {
 	// Basic
 	addPrimitiveWithArityRange(e, "list", 0, -1, primList)
-	addPrimitive(e, "apply", 2, primApply)
+	addControlPrimitive(e, "apply", 2, primApply)
 
 	// Math
 	addPrimitive(e, "+", 2, primAdd)
@@ -42,6 +42,15 @@ func initializePrimitives(e Env) {
 	addPrimitive(e, "cons", 2, primCons)
 	addPrimitiveWithArityRange(e, "concat", 0, -1, primConcat)
 
+	// Laziness
+	addControlPrimitive(e, "force", 1, primForce)
+	addControlPrimitive(e, "iterate", 2, primIterate)
+	addControlPrimitive(e, "lazy-map", 2, primLazyMap)
+	addPrimitiveWithArityRange(e, "range", 0, 3, primRange)
+	addPrimitive(e, "take", 2, primTake)
+	addPrimitive(e, "drop", 2, primDrop)
+	addControlPrimitiveWithArityRange(e, "yield", 0, 1, primYield)
+
 	// Environments and types
 	addPrimitive(e, "current-environment", 0, primCurrentEnvironment)
 	addPrimitive(e, "typeof", 1, primTypeof)
@@ -51,7 +60,10 @@ func initializePrimitives(e Env) {
 	addPrimitive(e, "routine-params", 1, primProcedureParams)
 	addPrimitive(e, "routine-body", 1, primProcedureBody)
 	addPrimitive(e, "routine-environment", 1, primProcedureEnvironment)
+	addPrimitive(e, "routine-location", 1, primRoutineLocation)
+	addPrimitive(e, "routine-arity", 1, primRoutineArity)
 	addPrimitive(e, "read-string", 1, primReadString)
+	addPrimitiveWithArityRange(e, "gensym", 0, 1, primGensym)
 	addPrimitive(e, "readable-string", 1, primReadableString)
 
 	// IO
@@ -59,108 +71,133 @@ func initializePrimitives(e Env) {
 	addPrimitiveWithArityRange(e, "read-line", 0, 0, primReadLine)
 	addPrimitive(e, "load", 1, primLoad)
 	addPrimitive(e, "now", 0, primNow)
-	addPrimitive(e, "sleep", 1, primSleep)
+	addControlPrimitive(e, "sleep", 1, primSleep)
 	addPrimitiveWithArityRange(e, "panic", 0, -1, primPanic)
 
+	// Errors
+	addPrimitiveWithArityRange(e, "raise", 1, 2, primRaise)
+	addPrimitive(e, "error-message", 1, primErrorMessage)
+	addPrimitive(e, "error-data", 1, primErrorData)
+	addPrimitive(e, "error-location", 1, primErrorLocation)
+	addPrimitive(e, "error-stack", 1, primErrorStack)
+	addControlPrimitiveWithArityRange(e, "invoke-restart", 1, -1, primInvokeRestart)
+	addControlPrimitive(e, "compute-restarts", 0, primComputeRestarts)
+	addControlPrimitive(e, "macroexpand-all", 1, primMacroexpandAll)
+
 	// Concurrency
 	addPrimitive(e, "chan", 0, primChan)
-	addPrimitive(e, "send!", 2, primSendBang)
-	addPrimitive(e, "take!", 1, primTakeBang)
+	addControlPrimitive(e, "send!", 2, primSendBang)
+	addControlPrimitive(e, "take!", 1, primTakeBang)
 	addPrimitive(e, "close!", 1, primCloseBang)
 
+	// Go values
+	addControlPrimitiveWithArityRange(e, "go-call", 2, -1, primGoCall)
+	addPrimitive(e, "go-field", 2, primGoField)
+	addPrimitive(e, "go-type", 1, primGoType)
+
 	// Special
 	addPrimitive(e, "__stacktrace", 0, primStacktrace)
 
 	// Predefined symbols
 
-	trueSymbol = &ast.Symbol{Name: "true"}
-	e.Set("true", trueSymbol)
-
-	falseSymbol = &ast.Symbol{Name: "false"}
-	e.Set("false", falseSymbol)
+	e.Set(trueSymbol, trueSymbol)
+	e.Set(falseSymbol, falseSymbol)
 }
 
 func addPrimitiveWithArityRange(e Env, name string, minArity int, maxArity int, f primitiveFunc) {
 	e.Set(
-		name,
+		ast.Intern(name),
 		NewPrimitive(name, minArity, maxArity, primitiveFunc(f)))
 }
 
 func addPrimitive(e Env, name string, arity int, f primitiveFunc) {
 	e.Set(
-		name,
+		ast.Intern(name),
 		NewPrimitive(name, arity, arity, primitiveFunc(f)))
 }
 
+func addControlPrimitiveWithArityRange(e Env, name string, minArity int, maxArity int, f controlPrimitiveFunc) {
+	e.Set(
+		ast.Intern(name),
+		newControlPrimitive(name, minArity, maxArity, f))
+}
+
+func addControlPrimitive(e Env, name string, arity int, f controlPrimitiveFunc) {
+	e.Set(
+		ast.Intern(name),
+		newControlPrimitive(name, arity, arity, f))
+}
+
 ////////// Primitives
 
-func primApply(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primApply(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
 	evaluatedHead := args[0]
 	switch headVal := evaluatedHead.(type) {
 	case Routine:
 		l := toListValue(args[1])
-		return trampoline(func() packet {
-			return evalInvokeRoutine(e, headVal, head, l.Nodes, true)
-		})
+		return applyRoutine(th, e, headVal, head, l.Nodes, k)
 	default:
 		panicEvalError(head, "First argument to 'apply' not a routine: "+headVal.String())
-		return &ast.Nil{}
+		return respond(&ast.Nil{})
 	}
 }
 
-func primAdd(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primAdd(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	result := toNumberValue(args[0]) + toNumberValue(args[1])
 	return &ast.Number{Value: result}
 }
 
-func primSubtract(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primSubtract(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	result := toNumberValue(args[0]) - toNumberValue(args[1])
 	return &ast.Number{Value: result}
 }
 
-func primEquals(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primEquals(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	if args[0].Equals(args[1]) {
 		return trueSymbol
 	}
 	return falseSymbol
 }
 
-func primLt(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primLt(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	if toNumberValue(args[0]) < toNumberValue(args[1]) {
 		return trueSymbol
 	}
 	return falseSymbol
 }
 
-func primGt(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primGt(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	if toNumberValue(args[0]) > toNumberValue(args[1]) {
 		return trueSymbol
 	}
 	return falseSymbol
 }
 
-func primDiv(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primDiv(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	result := toNumberValue(args[0]) / toNumberValue(args[1])
 	return &ast.Number{Value: result}
 }
 
-func primMult(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primMult(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	result := toNumberValue(args[0]) * toNumberValue(args[1])
 	return &ast.Number{Value: result}
 }
 
-func primList(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primList(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	return &ast.List{Nodes: args}
 }
 
-func primCurrentEnvironment(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primCurrentEnvironment(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	return NewEnvNode(e)
 }
 
-func primProcedureParams(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primProcedureParams(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 	switch val := arg.(type) {
 	case *Procedure:
+		if len(val.Clauses) > 0 {
+			return clauseParameters(val)
+		}
 		return ast.NewList(val.Parameters)
 	default:
 		panicEvalError(args[0], "Argument to 'routine-params' not a procedure: "+arg.String())
@@ -169,10 +206,17 @@ func primProcedureParams(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primProcedureBody(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primProcedureBody(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 	switch val := arg.(type) {
 	case *Procedure:
+		if len(val.Clauses) > 0 {
+			bodies := make([]ast.Node, len(val.Clauses))
+			for i, clause := range val.Clauses {
+				bodies[i] = clause.Body
+			}
+			return ast.NewList(bodies)
+		}
 		return val.Body
 	default:
 		panicEvalError(args[0], "Argument to 'routine-body' not a procedure: "+arg.String())
@@ -181,7 +225,7 @@ func primProcedureBody(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primProcedureEnvironment(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primProcedureEnvironment(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 	switch val := arg.(type) {
 	case *Procedure:
@@ -193,12 +237,73 @@ func primProcedureEnvironment(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primTypeof(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primRoutineLocation(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
-	return &ast.Symbol{Name: arg.TypeName()}
+	switch val := arg.(type) {
+	case *Procedure:
+		if val.Location == nil {
+			return &ast.Nil{}
+		}
+		return ast.NewList([]ast.Node{
+			ast.NewStr(val.Location.Filename),
+			&ast.Number{Value: float64(val.Location.Line)},
+			&ast.Number{Value: float64(val.Location.Column)},
+		})
+	case Routine:
+		return &ast.Nil{}
+	default:
+		panicEvalError(args[0], "Argument to 'routine-location' not a routine: "+arg.String())
+	}
+
+	return nil
+}
+
+func primRoutineArity(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	var minArity, maxArity int
+
+	arg := args[0]
+	switch val := arg.(type) {
+	case *Procedure:
+		minArity, maxArity = val.Arity()
+	case *Primitive:
+		minArity, maxArity = val.MinArity, val.MaxArity
+	case *Continuation:
+		minArity, maxArity = 0, 1
+	default:
+		panicEvalError(args[0], "Argument to 'routine-arity' not a routine: "+arg.String())
+	}
+
+	var maxNode ast.Node = &ast.Number{Value: float64(maxArity)}
+	if maxArity == -1 {
+		maxNode = &ast.Nil{}
+	}
+
+	return ast.NewList([]ast.Node{&ast.Number{Value: float64(minArity)}, maxNode})
 }
 
-func primPanic(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primGensym(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	if len(args) == 0 {
+		return in.gensym("G")
+	}
+
+	switch val := args[0].(type) {
+	case *ast.Str:
+		return in.gensym(val.Value)
+	case *ast.Symbol:
+		return in.gensym(val.Name)
+	default:
+		panicEvalError(args[0], "Argument to 'gensym' not a string or symbol: "+val.String())
+	}
+
+	return nil
+}
+
+func primTypeof(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	arg := args[0]
+	return ast.Intern(arg.TypeName())
+}
+
+func primPanic(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	var buffer bytes.Buffer
 
 	for i, arg := range args {
@@ -213,26 +318,101 @@ func primPanic(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return &ast.Nil{}
 }
 
-func primPrintln(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primRaise(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	if errorNode, ok := args[0].(*ErrorNode); ok && len(args) == 1 {
+		// Re-raise an error which has already been caught
+		panic(errorNode.Err)
+	}
+
+	err := newEvalErrorAt("Application error", args[0].FriendlyString(), head)
+	if len(args) == 2 {
+		err.Data = args[1]
+	}
+
+	panic(err)
+}
+
+func primErrorMessage(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	return ast.NewStr(toErrorValue(args[0]).Message)
+}
+
+func primErrorData(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	return toErrorValue(args[0]).Data
+}
+
+func primErrorLocation(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	loc := toErrorValue(args[0]).Location()
+	if loc == nil {
+		return &ast.Nil{}
+	}
+
+	return ast.NewList([]ast.Node{
+		ast.NewStr(loc.Filename),
+		&ast.Number{Value: float64(loc.Line)},
+	})
+}
+
+func primErrorStack(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	frames := toErrorValue(args[0]).Frames()
+
+	result := make([]ast.Node, len(frames))
+	for i, f := range frames {
+		result[i] = ast.NewList([]ast.Node{
+			ast.Intern(f.ProcedureName),
+			ast.NewStr(f.Filename),
+			&ast.Number{Value: float64(f.Line)},
+			&ast.Number{Value: float64(f.Column)},
+			ast.NewStr(f.Arguments),
+		})
+	}
+
+	return ast.NewList(result)
+}
+
+func primInvokeRestart(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	name := toSymbolValue(args[0])
+	r, ok := findRestart(th, name)
+	if !ok {
+		panicEvalError(head, "No restart named '"+name+"' is available")
+	}
+
+	return r.invoke(th, head, args[1:])
+}
+
+// primMacroexpandAll expands every macro call in a form, including those in
+// the expansions of other macro calls, without evaluating the result.
+func primMacroexpandAll(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	return expandAll(th, e, args[0], nil, k)
+}
+
+func primComputeRestarts(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	var names []ast.Node
+	for _, r := range availableRestarts(th) {
+		names = append(names, ast.Intern(r.Name))
+	}
+	return resume(k, ast.NewList(names))
+}
+
+func primPrintln(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	for i, arg := range args {
 		if i > 0 {
-			fmt.Fprintf(writer, " ")
+			fmt.Fprintf(in.writer, " ")
 		}
 
-		fmt.Fprintf(writer, "%v", arg.FriendlyString())
+		fmt.Fprintf(in.writer, "%v", arg.FriendlyString())
 	}
 
-	fmt.Fprintf(writer, "\n")
+	fmt.Fprintf(in.writer, "\n")
 	return &ast.Nil{}
 }
 
-func primReadLine(e Env, head ast.Node, args []ast.Node) ast.Node {
-	s := readLine() // TODO: uses a global variable :(
+func primReadLine(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	s := in.readLine()
 	trimmed := strings.TrimSuffix(s, "\n")
 	return ast.NewStr(trimmed)
 }
 
-func primLen(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primLen(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 
 	switch val := arg.(type) {
@@ -244,7 +424,7 @@ func primLen(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primFirst(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primFirst(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 
 	switch val := arg.(type) {
@@ -256,7 +436,7 @@ func primFirst(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primRest(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primRest(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 
 	switch val := arg.(type) {
@@ -268,7 +448,7 @@ func primRest(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primCons(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primCons(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	sourceElement := args[0]
 	targetColl := args[1]
 
@@ -286,7 +466,7 @@ func primCons(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primUpdateElementBang(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primUpdateElementBang(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	leftHandSide := args[0]
 
 	indexNode := args[1]
@@ -309,11 +489,11 @@ func primUpdateElementBang(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return &ast.Nil{}
 }
 
-func primReadableString(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primReadableString(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	return ast.NewStr(args[0].String())
 }
 
-func primStr(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primStr(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	var buffer bytes.Buffer
 
 	// TODO replace below with calls to .FriendlyString()
@@ -324,7 +504,7 @@ func primStr(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return ast.NewStr(buffer.String())
 }
 
-func primConcat(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primConcat(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	var sum ast.Node
 
 	for _, arg := range args {
@@ -356,7 +536,7 @@ func primConcat(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return sum
 }
 
-func primLoad(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primLoad(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 	switch val := arg.(type) {
 	case *ast.Str:
@@ -369,7 +549,7 @@ func primLoad(e Env, head ast.Node, args []ast.Node) ast.Node {
 					arg,
 					fmt.Sprintf("Error while loading file <%v>: %v\n", fileName, err.Error()))
 			} else {
-				ParseEvalPrint(e, content, readLine, fileName, false)
+				in.parseEvalPrint(e, content, fileName, false)
 			}
 		}
 
@@ -380,7 +560,7 @@ func primLoad(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primNow(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primNow(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 
 	t := time.Now()
 	year, month, day := t.Date()
@@ -398,21 +578,29 @@ func primNow(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return result
 }
 
-func primSleep(e Env, head ast.Node, args []ast.Node) ast.Node {
+// primSleep waits for a number of milliseconds, or until the evaluation is
+// interrupted.
+func primSleep(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
 
 	arg := args[0]
 
 	switch val := arg.(type) {
 	case *ast.Number:
-		time.Sleep(time.Duration(val.Value) * time.Millisecond)
-		return &ast.Nil{}
+		timer := time.NewTimer(time.Duration(val.Value) * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-th.done():
+			th.interrupt()
+		}
+		return resume(k, &ast.Nil{})
 	}
 
 	panicEvalError(arg, "Argument to 'sleep' not a number: "+arg.String())
-	return nil
+	return packet{}
 }
 
-func primReadString(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primReadString(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	arg := args[0]
 	switch val := arg.(type) {
 	case *ast.Str:
@@ -434,40 +622,52 @@ func primReadString(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return nil
 }
 
-func primChan(e Env, head ast.Node, args []ast.Node) ast.Node {
-	return NewChan()
+func primChan(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	return NewChan(in.nextChannelNumber())
 }
 
-func primSendBang(e Env, head ast.Node, args []ast.Node) ast.Node {
+// primSendBang sends a value on a channel, waiting until it is taken or the
+// evaluation is interrupted.
+func primSendBang(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
 	chanArg := args[0]
 	switch chanVal := chanArg.(type) {
 	case *Chan:
 		messageArg := args[1]
-		chanVal.Value <- messageArg
+		select {
+		case chanVal.Value <- messageArg:
+		case <-th.done():
+			th.interrupt()
+		}
 	default:
 		panicEvalError(head, "Target of a send! must be a chan: "+chanArg.String())
 	}
 
-	return &ast.Nil{}
+	return resume(k, &ast.Nil{})
 }
 
-func primTakeBang(e Env, head ast.Node, args []ast.Node) ast.Node {
+// primTakeBang takes a value from a channel, waiting until one is sent, the
+// channel is closed or the evaluation is interrupted.
+func primTakeBang(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
 	chanArg := args[0]
 	switch chanVal := chanArg.(type) {
 	case *Chan:
-		n, more := <-chanVal.Value
-		if !more {
-			return &ast.Nil{}
+		select {
+		case n, more := <-chanVal.Value:
+			if !more {
+				return resume(k, &ast.Nil{})
+			}
+			return resume(k, n)
+		case <-th.done():
+			th.interrupt()
 		}
-		return n
 	default:
 		panicEvalError(head, "Source of a take! must be a chan: "+chanArg.String())
 	}
 
-	return &ast.Nil{}
+	return resume(k, &ast.Nil{})
 }
 
-func primCloseBang(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primCloseBang(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	chanArg := args[0]
 	switch chanVal := chanArg.(type) {
 	case *Chan:
@@ -479,7 +679,7 @@ func primCloseBang(e Env, head ast.Node, args []ast.Node) ast.Node {
 	return &ast.Nil{}
 }
 
-func primStacktrace(e Env, head ast.Node, args []ast.Node) ast.Node {
+func primStacktrace(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
 	debug.PrintStack()
 	//println("Stacktrace: ", len(debug.Stack()))
 	return &ast.Nil{}
@@ -0,0 +1,96 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Quasiquote
+
+// specialQuasiquote builds the data structure described by a template,
+// evaluating the parts of it which are marked with 'unquote' (,x) and splicing
+// in the elements of those marked with 'unquote-splicing' (,@xs).
+func specialQuasiquote(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	return expandQuasiquote(th, e, args[0], 1, k)
+}
+
+// expandQuasiquote expands a template nested inside depth quasiquotes. Only
+// unquotes at depth 1 are evaluated; deeper ones are rebuilt with their depth
+// reduced, so that an inner quasiquote can expand them later.
+func expandQuasiquote(th *thread, e Env, template ast.Node, depth int, k *continuation) packet {
+	l, ok := template.(*ast.List)
+	if !ok || len(l.Nodes) == 0 {
+		return resume(k, stripAliases(template))
+	}
+
+	switch quotingFormName(l) {
+	case "unquote":
+		checkSpecialArgs("unquote", l.Nodes[0], l.Nodes[1:], 1, 1)
+		if depth == 1 {
+			return evalNode(th, e, l.Nodes[1], k)
+		}
+		return expandQuotingForm(th, e, l, depth-1, k)
+	case "unquote-splicing":
+		checkSpecialArgs("unquote-splicing", l.Nodes[0], l.Nodes[1:], 1, 1)
+		if depth == 1 {
+			panicEvalError(l.Nodes[0], "'unquote-splicing' used outside of a list: "+l.String())
+		}
+		return expandQuotingForm(th, e, l, depth-1, k)
+	case "quasiquote":
+		checkSpecialArgs("quasiquote", l.Nodes[0], l.Nodes[1:], 1, 1)
+		return expandQuotingForm(th, e, l, depth+1, k)
+	}
+
+	return expandQuasiquoteElements(th, e, l.Nodes, make([]ast.Node, 0, len(l.Nodes)), depth, k)
+}
+
+// expandQuotingForm rebuilds a nested quoting form such as (unquote x), with
+// its argument expanded at the given depth.
+func expandQuotingForm(th *thread, e Env, l *ast.List, depth int, k *continuation) packet {
+	return expandQuasiquote(th, e, l.Nodes[1], depth, then(th, func(th *thread, expanded ast.Node) packet {
+		return resume(k, ast.NewList([]ast.Node{l.Nodes[0], expanded}))
+	}))
+}
+
+// expandQuasiquoteElements expands the elements of a list template one at a
+// time, collecting the results in expanded.
+func expandQuasiquoteElements(th *thread, e Env, ns []ast.Node, expanded []ast.Node, depth int, k *continuation) packet {
+	if len(ns) == 0 {
+		return resume(k, ast.NewList(expanded))
+	}
+
+	// A continuation may be resumed more than once, so the results gathered so
+	// far are copied rather than appended to in place
+	extend := func(elems ...ast.Node) []ast.Node {
+		next := make([]ast.Node, len(expanded), len(expanded)+len(elems))
+		copy(next, expanded)
+		return append(next, elems...)
+	}
+
+	if l, ok := ns[0].(*ast.List); ok && depth == 1 && quotingFormName(l) == "unquote-splicing" {
+		checkSpecialArgs("unquote-splicing", l.Nodes[0], l.Nodes[1:], 1, 1)
+		return evalNode(th, e, l.Nodes[1], then(th, func(th *thread, spliced ast.Node) packet {
+			coll, ok := spliced.(ast.Coll)
+			if !ok {
+				panicEvalError(l.Nodes[0], "Value of 'unquote-splicing' not a collection: "+spliced.String())
+			}
+			return expandQuasiquoteElements(th, e, ns[1:], extend(coll.Children()...), depth, k)
+		}))
+	}
+
+	return expandQuasiquote(th, e, ns[0], depth, then(th, func(th *thread, elem ast.Node) packet {
+		return expandQuasiquoteElements(th, e, ns[1:], extend(elem), depth, k)
+	}))
+}
+
+// quotingFormName returns the name of the special form heading the list if
+// it is one of the quasiquote forms, or an empty string otherwise.
+func quotingFormName(l *ast.List) string {
+	if len(l.Nodes) == 0 {
+		return ""
+	}
+	if s, ok := l.Nodes[0].(*ast.Symbol); ok {
+		switch name := s.Base().Name; name {
+		case "quasiquote", "unquote", "unquote-splicing":
+			return name
+		}
+	}
+	return ""
+}
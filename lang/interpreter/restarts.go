@@ -0,0 +1,81 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Restart
+
+// Restart is a named way of continuing a computation after an error has been
+// raised, without unwinding to a 'try' form. Restarts are established by
+// 'restart-case' forms and by the interpreter itself, and are invoked by
+// error handlers or, for errors which escape evaluation, by the host.
+type Restart struct {
+	Name       string
+	Parameters ast.Nodes
+	invoke     func(th *thread, head ast.Node, args []ast.Node) packet
+	parent     *Restart
+}
+
+func pushRestart(th *thread, name string, parameters ast.Nodes, invoke func(*thread, ast.Node, []ast.Node) packet) {
+	th.restarts = &Restart{
+		Name:       name,
+		Parameters: parameters,
+		invoke:     invoke,
+		parent:     th.restarts,
+	}
+}
+
+// String returns the restart as it appears in a list of restarts.
+func (r *Restart) String() string {
+	return r.Name + " " + r.Parameters.String()
+}
+
+// InvokeRestart continues the computation which raised an error by invoking
+// one of the restarts available when the error escaped evaluation by the
+// interpreter. The result is that of the top-level evaluation which raised
+// the error.
+func (in *Interpreter) InvokeRestart(r *Restart, args []ast.Node) (result ast.Node, err error) {
+	head := ast.Intern(r.Name)
+	return in.run(func(th *thread) packet {
+		return r.invoke(th, head, args)
+	})
+}
+
+// findRestart returns the innermost available restart with the given name.
+func findRestart(th *thread, name string) (*Restart, bool) {
+	for r := th.restarts; r != nil; r = r.parent {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// availableRestarts lists the restarts of the thread, innermost first.
+func availableRestarts(th *thread) []*Restart {
+	var restarts []*Restart
+	for r := th.restarts; r != nil; r = r.parent {
+		restarts = append(restarts, r)
+	}
+	return restarts
+}
+
+// signalUndefinedName raises an error for a name which is not defined,
+// offering the restarts 'use-value', to continue as if the name had the
+// given value, and 'retry', to look the name up again.
+func signalUndefinedName(th *thread, e Env, name *ast.Symbol, k *continuation) packet {
+	outer := th.dynamicState
+
+	pushRestart(th, "retry", ast.Nodes{}, func(th *thread, head ast.Node, args []ast.Node) packet {
+		checkBuiltinArgs("Restart", "retry", head, args, 0, 0)
+		th.dynamicState = outer
+		return evalNode(th, e, name, k)
+	})
+	pushRestart(th, "use-value", ast.Nodes{ast.Intern("value")}, func(th *thread, head ast.Node, args []ast.Node) packet {
+		checkBuiltinArgs("Restart", "use-value", head, args, 1, 1)
+		th.dynamicState = outer
+		return resume(k, args[0])
+	})
+
+	panicEvalError(name, "Name not defined: "+name.Base().Name)
+	return respond(nil)
+}
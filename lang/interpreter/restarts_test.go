@@ -0,0 +1,52 @@
+package interpreter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/parser"
+	"github.com/onlyafly/vamos/testhelp"
+)
+
+func TestInvokeRestart_ContinuesEscapedError(t *testing.T) {
+	nodes, _ := parser.Parse("(list 1 (+ 1 missing) 3)", "test")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+
+	_, err := in.Eval(nodes[0])
+	evalErr, ok := err.(*EvalError)
+	if !ok {
+		t.Fatalf("Expected an EvalError, got <%v>", err)
+	}
+
+	testhelp.CheckEqualInt(t, 2, len(evalErr.Restarts))
+	testhelp.CheckEqualString(t, "use-value (value)", evalErr.Restarts[0].String())
+	testhelp.CheckEqualString(t, "retry ()", evalErr.Restarts[1].String())
+
+	result, err := in.InvokeRestart(evalErr.Restarts[0], []ast.Node{&ast.Number{Value: 41}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	testhelp.CheckEqualString(t, "(1 42 3)", result.String())
+
+	// The computation can be continued again from the same restart
+	result, _ = in.InvokeRestart(evalErr.Restarts[0], []ast.Node{&ast.Number{Value: 1}})
+	testhelp.CheckEqualString(t, "(1 2 3)", result.String())
+}
+
+func TestInvokeRestart_WrongNumberOfArguments(t *testing.T) {
+	nodes, _ := parser.Parse("missing", "test")
+
+	var out bytes.Buffer
+	readLine := func() string { return "" }
+	in := New(&out, readLine)
+
+	_, err := in.Eval(nodes[0])
+	evalErr := err.(*EvalError)
+
+	_, err = in.InvokeRestart(evalErr.Restarts[0], nil)
+	testhelp.CheckEqualString(t, "Evaluation error: Restart 'use-value' expects 1 argument(s), but was given 0", err.Error())
+}
@@ -2,6 +2,10 @@ package interpreter
 
 import (
 	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
 	"github.com/onlyafly/vamos/lang/ast"
 	"github.com/onlyafly/vamos/lang/token"
 )
@@ -33,6 +37,69 @@ func (en *EnvNode) Equals(n ast.Node) bool {
 	return false
 }
 
+////////// GoValue
+
+// GoValue is a value handed to Vamos code by a Go program, such as a database
+// handle, which has no Vamos counterpart. Vamos code can pass it around, and
+// use it with 'go-call', 'go-field' and 'go-type'.
+type GoValue struct {
+	Value interface{}
+}
+
+func NewGoValue(value interface{}) *GoValue {
+	return &GoValue{Value: value}
+}
+
+func (gv *GoValue) String() string         { return "#go<" + gv.TypeName() + ">" }
+func (gv *GoValue) FriendlyString() string { return fmt.Sprint(gv.Value) }
+func (gv *GoValue) isExpr() bool           { return true }
+func (gv *GoValue) TypeName() string       { return goTypeName(reflect.ValueOf(gv.Value)) }
+func (gv *GoValue) Loc() *token.Location   { return nil }
+func (gv *GoValue) Equals(n ast.Node) (equal bool) {
+	other, ok := n.(*GoValue)
+	if !ok || reflect.TypeOf(gv.Value) != reflect.TypeOf(other.Value) {
+		return false
+	}
+	if gv.Value != nil && !reflect.TypeOf(gv.Value).Comparable() {
+		panicEvalError(n, "Cannot compare the values of Go values of type "+gv.TypeName())
+	}
+
+	// Values of a comparable type, such as a struct, can still hold interface
+	// values of a type which is not
+	defer func() {
+		if e := recover(); e != nil {
+			panicEvalError(n, "Cannot compare the values of Go values of type "+gv.TypeName())
+		}
+	}()
+	return gv.Value == other.Value
+}
+
+////////// ErrorNode
+
+// ErrorNode is an error as seen by Vamos code, such as the value bound by the
+// catch clause of a 'try' form.
+type ErrorNode struct {
+	Err *EvalError
+}
+
+func NewErrorNode(err *EvalError) *ErrorNode {
+	return &ErrorNode{Err: err}
+}
+
+func (en *ErrorNode) String() string {
+	return "#error<" + en.Err.Message + ">"
+}
+func (en *ErrorNode) FriendlyString() string { return en.Err.Error() }
+func (en *ErrorNode) isExpr() bool           { return true }
+func (en *ErrorNode) TypeName() string       { return "error" }
+func (en *ErrorNode) Loc() *token.Location   { return en.Err.Location() }
+func (en *ErrorNode) Equals(n ast.Node) bool {
+	if other, ok := n.(*ErrorNode); ok {
+		return en.Err == other.Err
+	}
+	return false
+}
+
 ////////// Routine
 
 type Routine interface {
@@ -42,11 +109,16 @@ type Routine interface {
 
 ////////// Primitive
 
-type primitiveFunc func(Env, ast.Node, []ast.Node) ast.Node
+type primitiveFunc func(*Interpreter, Env, ast.Node, []ast.Node) ast.Node
+
+// A controlPrimitiveFunc is the implementation of a primitive which needs to
+// decide for itself how evaluation continues, such as 'apply'.
+type controlPrimitiveFunc func(*thread, Env, ast.Node, []ast.Node, *continuation) packet
 
 type Primitive struct {
 	Name     string
 	Value    primitiveFunc
+	Control  controlPrimitiveFunc
 	MinArity int
 	MaxArity int
 }
@@ -60,6 +132,15 @@ func NewPrimitive(name string, minArity int, maxArity int, value primitiveFunc)
 	}
 }
 
+func newControlPrimitive(name string, minArity int, maxArity int, control controlPrimitiveFunc) *Primitive {
+	return &Primitive{
+		Name:     name,
+		Control:  control,
+		MinArity: minArity,
+		MaxArity: maxArity,
+	}
+}
+
 func (p *Primitive) String() string {
 	return "#primitive<" + p.Name + ">"
 }
@@ -82,6 +163,12 @@ type Procedure struct {
 	Body       ast.Node
 	ParentEnv  Env
 	IsMacro    bool
+	Location   *token.Location // Where the proc form defining the procedure is
+	Clauses    []*Procedure    // For a procedure with several arities, one per arity
+
+	parsedParameters atomic.Pointer[parameterList]
+	compiledBody     atomic.Pointer[code]
+	analyzedBody     atomic.Pointer[analyzedBody]
 }
 
 func (f *Procedure) String() string {
@@ -94,34 +181,183 @@ func (f *Procedure) String() string {
 func (p *Procedure) FriendlyString() string { return p.String() }
 func (p *Procedure) RoutineName() string    { return p.Name }
 func (f *Procedure) isExpr() bool           { return true }
-func (f *Procedure) Loc() *token.Location   { return nil }
+func (f *Procedure) Loc() *token.Location   { return f.Location }
 func (f *Procedure) TypeName() string {
 	if f.IsMacro {
 		return "macro_procedure"
 	}
 	return "procedure"
 }
+
+// Arity returns the minimum and maximum number of arguments the procedure
+// accepts. The maximum is -1 if there is no limit.
+func (f *Procedure) Arity() (int, int) {
+	if len(f.Clauses) == 0 {
+		return f.parameterList(f).arity()
+	}
+
+	minArity, maxArity := f.Clauses[0].Arity()
+	for _, clause := range f.Clauses[1:] {
+		clauseMin, clauseMax := clause.Arity()
+		if clauseMin < minArity {
+			minArity = clauseMin
+		}
+		if maxArity != -1 && (clauseMax == -1 || clauseMax > maxArity) {
+			maxArity = clauseMax
+		}
+	}
+	return minArity, maxArity
+}
+
+// parameterList returns the parameters of the procedure divided into their
+// groups, panicking at head if they are malformed. They are only parsed the
+// first time they are needed.
+func (f *Procedure) parameterList(head ast.Node) *parameterList {
+	if pl := f.parsedParameters.Load(); pl != nil {
+		return pl
+	}
+	pl := parseParameters(head, f.Parameters)
+	f.parsedParameters.Store(pl)
+	return pl
+}
+
+// bytecode returns the body of the procedure compiled for the virtual machine,
+// compiling it the first time it is needed. A procedure created by compiled
+// code is given the body compiled along with that code instead.
+func (f *Procedure) bytecode() *code {
+	if c := f.compiledBody.Load(); c != nil {
+		return c
+	}
+	c := compileBody(f.parameterList(f), f.Body, nil)
+	f.compiledBody.Store(c)
+	return c
+}
+
+// analysis returns the body of the procedure analysed into closures, which is
+// analysed the first time it is needed.
+func (f *Procedure) analysis() *analyzedBody {
+	if body := f.analyzedBody.Load(); body != nil {
+		return body
+	}
+	body := analyzeBody(f.parameterList(f), f.Body, nil)
+	f.analyzedBody.Store(body)
+	return body
+}
+
+// clauseFor returns the clause of the procedure which accepts the given number
+// of arguments, or nil if there is none. A procedure without clauses is its
+// own single clause.
+func (f *Procedure) clauseFor(argCount int) *Procedure {
+	if len(f.Clauses) == 0 {
+		return f
+	}
+
+	for _, clause := range f.Clauses {
+		minArity, maxArity := clause.Arity()
+		if minArity <= argCount && (maxArity == -1 || argCount <= maxArity) {
+			return clause
+		}
+	}
+	return nil
+}
+
 func (f *Procedure) Equals(n ast.Node) bool {
 	panicEvalError(n, "Cannot compare the values of procedures: "+
 		f.String()+" and "+n.String())
 	return false
 }
 
-////////// Chan
+////////// Continuation
 
-var channelNumber int
+// Continuation is a first-class continuation, as captured by call/cc.
+type Continuation struct {
+	K     *continuation
+	state dynamicState
+}
+
+func newContinuation(th *thread, k *continuation) *Continuation {
+	return &Continuation{K: k, state: th.dynamicState}
+}
+
+func (c *Continuation) String() string         { return "#continuation" }
+func (c *Continuation) FriendlyString() string { return c.String() }
+func (c *Continuation) RoutineName() string    { return "continuation" }
+func (c *Continuation) isExpr() bool           { return true }
+func (c *Continuation) Loc() *token.Location   { return nil }
+func (c *Continuation) TypeName() string       { return "continuation" }
+func (c *Continuation) Equals(n ast.Node) bool {
+	panicEvalError(n, "Cannot compare the values of continuations: "+
+		c.String()+" and "+n.String())
+	return false
+}
+
+////////// DynamicVar
+
+// DynamicVar is a variable defined by 'defdynamic'. It is bound in an
+// environment like any other name, but evaluating the name gives the value of
+// the variable in the current thread rather than the DynamicVar itself.
+type DynamicVar struct {
+	Name string
+	Root ast.Node // The value of the variable where it has not been rebound
+}
+
+func (dv *DynamicVar) String() string         { return "#dynamic<" + dv.Name + ">" }
+func (dv *DynamicVar) FriendlyString() string { return dv.String() }
+func (dv *DynamicVar) isExpr() bool           { return true }
+func (dv *DynamicVar) Loc() *token.Location   { return nil }
+func (dv *DynamicVar) TypeName() string       { return "dynamic" }
+func (dv *DynamicVar) Equals(n ast.Node) bool { return dv == n }
+
+////////// Promise
+
+// Promise is a delayed evaluation, as created by 'delay'. Its expression is
+// evaluated the first time it is forced, and the value is remembered.
+type Promise struct {
+	Env  Env
+	Expr ast.Node
+
+	mu    sync.Mutex
+	value ast.Node // nil until the promise has been forced
+}
+
+// forcedValue returns the value of the promise, or nil if it has not been
+// forced yet.
+func (p *Promise) forcedValue() ast.Node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.value
+}
+
+// fulfill remembers the value of the promise and returns it. If the promise
+// was forced again while its expression was being evaluated, the value from
+// then is kept.
+func (p *Promise) fulfill(value ast.Node) ast.Node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.value == nil {
+		p.value = value
+	}
+	return p.value
+}
+
+func (p *Promise) String() string         { return "#promise" }
+func (p *Promise) FriendlyString() string { return p.String() }
+func (p *Promise) isExpr() bool           { return true }
+func (p *Promise) Loc() *token.Location   { return nil }
+func (p *Promise) TypeName() string       { return "promise" }
+func (p *Promise) Equals(n ast.Node) bool { return p == n }
+
+////////// Chan
 
 type Chan struct {
 	id    int
 	Value chan ast.Node
 }
 
-func NewChan() *Chan {
-	cn := channelNumber
-	channelNumber++
-
+// NewChan creates a channel, which is shown with the given number.
+func NewChan(id int) *Chan {
 	return &Chan{
-		id:    cn,
+		id:    id,
 		Value: make(chan ast.Node),
 	}
 }
@@ -0,0 +1,120 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Lexical Addressing
+
+// A scope is the variables of a frame, as known when compiling code which runs
+// in it. A nil scope stands for environments whose variables are not known,
+// such as the top level, in which variables are looked up by name.
+type scope struct {
+	names  []*ast.Symbol
+	parent *scope
+}
+
+// resolve finds the frame and slot of the variable a symbol refers to, if it
+// is in a known scope. A symbol renamed by a hygienic macro is always looked
+// up by name, since it may stand for a variable in another environment.
+func (sc *scope) resolve(symbol *ast.Symbol) (depth int, slot int, ok bool) {
+	if symbol.Alias != nil {
+		return 0, 0, false
+	}
+	symbol = symbol.Interned()
+	for ; sc != nil; sc, depth = sc.parent, depth+1 {
+		for i, name := range sc.names {
+			if name == symbol {
+				return depth, i, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// depth returns how many frames out from the innermost the scope knows the
+// variables of.
+func (sc *scope) depth() int {
+	n := 0
+	for ; sc != nil; sc = sc.parent {
+		n++
+	}
+	return n
+}
+
+// lookupPast returns the value a symbol refers to which is in none of the
+// depth frames out from e, without looking through their slots. A frame on
+// the way which has had the name defined in it at run time is still looked in,
+// as is every environment for a symbol renamed by a hygienic macro.
+func lookupPast(e Env, symbol *ast.Symbol, depth int) (ast.Node, bool) {
+	if symbol.Alias == nil {
+		name := symbol.Interned()
+		for ; depth > 0; depth-- {
+			f := e.(*FrameEnv)
+			if f.extra != nil {
+				if value, ok := f.extra[name]; ok {
+					return value, true
+				}
+			}
+			e = f.parent
+		}
+	}
+	return lookupSymbol(e, symbol)
+}
+
+// loadLocal returns the value in a slot of the frame depth frames out from e,
+// or nil if the slot has not been set yet. A frame on the way which has had
+// the name defined in it at run time, such as by 'eval', takes precedence.
+func loadLocal(e Env, symbol *ast.Symbol, depth int, slot int) ast.Node {
+	for ; depth > 0; depth-- {
+		f := e.(*FrameEnv)
+		if f.extra != nil {
+			if value, ok := f.extra[symbol.Interned()]; ok {
+				return value
+			}
+		}
+		e = f.parent
+	}
+	return e.(*FrameEnv).values[slot]
+}
+
+////////// Helpers
+
+// isBindingList reports whether a node is a list of variables and values which
+// the compiler can compile a let form for.
+func isBindingList(n ast.Node) bool {
+	l, ok := n.(*ast.List)
+	return ok && len(l.Nodes)%2 == 0
+}
+
+func isSymbol(n ast.Node) bool {
+	_, ok := n.(*ast.Symbol)
+	return ok
+}
+
+// tryParseParameters parses a parameter list, reporting whether it is well
+// formed rather than raising an error.
+func tryParseParameters(params []ast.Node) (pl *parameterList, ok bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, isEvalError := e.(*EvalError); !isEvalError {
+				panic(e)
+			}
+			pl, ok = nil, false
+		}
+	}()
+	return parseParameters(nil, params), true
+}
+
+// patternNames appends the names bound by a pattern to names.
+func patternNames(pattern ast.Node, names []*ast.Symbol) []*ast.Symbol {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		names = append(names, p.Interned())
+	case *ast.List:
+		for _, child := range p.Nodes {
+			if !isKeyword(child, "&rest") {
+				names = patternNames(child, names)
+			}
+		}
+	}
+	return names
+}
@@ -6,55 +6,74 @@ package interpreter
 
 import "github.com/onlyafly/vamos/lang/ast"
 
-func specialQuote(e Env, head ast.Node, args []ast.Node) packet {
-	return respond(args[0])
+func specialQuote(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	return resume(k, stripAliases(args[0]))
 }
 
-func specialUpdateBang(e Env, head ast.Node, args []ast.Node) packet {
-	name := toSymbolName(args[0])
-	rightHandSide := trampoline(func() packet {
-		return evalNode(e, args[1])
-	})
-	if ok := e.Update(name, rightHandSide); !ok {
-		panicEvalError(head, "Cannot 'update!' an undefined name: "+name)
+func specialUpdateBang(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	toSymbolName(args[0]) // Panics if the name is not a symbol
+	return evalNode(th, e, args[1], then(th, func(th *thread, rightHandSide ast.Node) packet {
+		updateName(th, e, head, args[0].(*ast.Symbol), rightHandSide)
+		return resume(k, &ast.Nil{})
+	}))
+}
+
+// updateName gives a new value to the variable or dynamic variable a symbol
+// refers to.
+func updateName(th *thread, e Env, head ast.Node, symbol *ast.Symbol, value ast.Node) {
+	if current, ok := lookupSymbol(e, symbol); ok {
+		if dv, ok := current.(*DynamicVar); ok {
+			updateDynamicValue(th, dv, value)
+			return
+		}
+	}
+	if ok := updateSymbol(e, symbol, value); !ok {
+		panicEvalError(head, "Cannot 'update!' an undefined name: "+symbol.Name)
 	}
-	return respond(&ast.Nil{})
 }
 
-func specialIf(e Env, head ast.Node, args []ast.Node) packet {
-	predicate := toBooleanValue(trampoline(func() packet {
-		return evalNode(e, args[0])
+func specialIf(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	if predicateNode, ok := evalSimple(th, e, args[0]); ok {
+		return evalIfBranch(th, e, args, predicateNode, k)
+	}
+	return evalNode(th, e, args[0], then(th, func(th *thread, predicateNode ast.Node) packet {
+		return evalIfBranch(th, e, args, predicateNode, k)
 	}))
+}
 
-	if predicate {
-		return bounce(func() packet {
-			return evalNode(e, args[1])
-		})
+func evalIfBranch(th *thread, e Env, args []ast.Node, predicateNode ast.Node, k *continuation) packet {
+	if toBooleanValue(predicateNode) {
+		return evalNode(th, e, args[1], k)
 	}
+	return evalNode(th, e, args[2], k)
+}
 
-	return bounce(func() packet {
-		return evalNode(e, args[2])
-	})
+func specialCond(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	return evalCondClause(th, e, head, args, 0, k)
 }
 
-func specialCond(e Env, head ast.Node, args []ast.Node) packet {
-	for i := 0; i < len(args); i += 2 {
-		predicate := toBooleanValue(trampoline(func() packet {
-			return evalNode(e, args[i])
-		}))
+func evalCondClause(th *thread, e Env, head ast.Node, args []ast.Node, i int, k *continuation) packet {
+	if i >= len(args) {
+		panicEvalError(head, "No matching cond clause: "+head.String())
+		return respond(&ast.Nil{})
+	}
 
-		if predicate {
-			return bounce(func() packet {
-				return evalNode(e, args[i+1])
-			})
+	if predicateNode, ok := evalSimple(th, e, args[i]); ok {
+		if toBooleanValue(predicateNode) {
+			return evalNode(th, e, args[i+1], k)
 		}
+		return evalCondClause(th, e, head, args, i+2, k)
 	}
 
-	panicEvalError(head, "No matching cond clause: "+head.String())
-	return respond(&ast.Nil{})
+	return evalNode(th, e, args[i], then(th, func(th *thread, predicateNode ast.Node) packet {
+		if toBooleanValue(predicateNode) {
+			return evalNode(th, e, args[i+1], k)
+		}
+		return evalCondClause(th, e, head, args, i+2, k)
+	}))
 }
 
-func specialLet(parentEnv Env, head ast.Node, args []ast.Node) packet {
+func specialLet(th *thread, parentEnv Env, head ast.Node, args []ast.Node, k *continuation) packet {
 	body := args[1]
 
 	var variableNodes ast.Nodes
@@ -67,140 +86,381 @@ func specialLet(parentEnv Env, head ast.Node, args []ast.Node) packet {
 
 	e := NewMapEnv("let", parentEnv)
 
-	// Evaluate variable assignments
-	for i := 0; i < len(variableNodes); i += 2 {
-		variable := variableNodes[i]
-		expression := variableNodes[i+1]
-		variableName := toSymbolName(variable)
+	return evalLetBinding(th, e, variableNodes, 0, then(th, func(th *thread, _ ast.Node) packet {
+		// Evaluate body
+		return bounce(func() packet {
+			return evalNode(th, e, body, k)
+		})
+	}))
+}
 
-		e.Set(variableName, trampoline(func() packet {
-			return evalNode(e, expression)
-		}))
+// evalLetBinding evaluates the variable assignments of a let, starting with
+// the i-th variable.
+func evalLetBinding(th *thread, e *MapEnv, variableNodes ast.Nodes, i int, k *continuation) packet {
+	if i >= len(variableNodes) {
+		return resume(k, &ast.Nil{})
 	}
 
-	// Evaluate body
-	return bounce(func() packet {
-		return evalNode(e, body)
-	})
-}
+	variable := variableNodes[i]
+	expression := variableNodes[i+1]
+	checkPattern("Let variables", variable, variable)
 
-func specialGo(e Env, head ast.Node, args []ast.Node) packet {
-	go evalEachNode(e, args)
-	return respond(&ast.Nil{})
+	return evalNode(th, e, expression, then(th, func(th *thread, value ast.Node) packet {
+		bindPattern(e, variable, value)
+		return evalLetBinding(th, e, variableNodes, i+2, k)
+	}))
 }
 
-func specialBegin(e Env, head ast.Node, args []ast.Node) packet {
-	results := evalEachNode(e, args)
-
-	if len(results) == 0 {
-		return respond(&ast.Nil{})
-	}
+func specialGo(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	goThread := newThread(th.interp)
+	goThread.bindings = copyBindings(th.bindings)
+	goThread.maxDepth = th.maxDepth
+	go func() {
+		defer func() {
+			// A thread which realizes a lazy sequence while an evaluation is
+			// interrupted stops along with it
+			if e := recover(); e != nil {
+				if _, ok := e.(*InterruptError); !ok {
+					panic(e)
+				}
+			}
+		}()
+		trampoline(goThread, func() packet {
+			return evalSequence(goThread, e, args, endContinuation)
+		})
+	}()
+	return resume(k, &ast.Nil{})
+}
 
-	return respond(results[len(results)-1])
+// specialBegin evaluates its arguments in order, the last in tail position.
+func specialBegin(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	return evalSequence(th, e, args, k)
 }
 
-func specialDef(e Env, head ast.Node, args []ast.Node) packet {
-	name := toSymbolName(args[0])
+func specialDef(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	name := toSymbol(args[0])
 
-	rightHandSide := trampoline(func() packet {
-		return evalNode(e, args[1])
-	})
+	return evalNode(th, e, args[1], then(th, func(th *thread, rightHandSide ast.Node) packet {
+		defineName(e, head, name, rightHandSide)
+		return resume(k, &ast.Nil{})
+	}))
+}
 
-	switch val := rightHandSide.(type) {
+// defineName gives a name its initial value in an environment.
+func defineName(e Env, head ast.Node, name *ast.Symbol, value ast.Node) {
+	switch val := value.(type) {
 	case *Procedure:
 		// Give a name to the procedure, allowing for better error messages
-		val.Name = name
+		val.Name = name.Name
+		for _, clause := range val.Clauses {
+			clause.Name = name.Name
+		}
 	}
 
 	if _, exists := e.Get(name); exists {
-		panicEvalError(head, "Cannot redefine a name: "+name)
+		panicEvalError(head, "Cannot redefine a name: "+name.Name)
 	} else {
-		e.Set(name, rightHandSide)
+		e.Set(name, value)
 	}
-
-	return respond(&ast.Nil{})
 }
 
-func specialEval(e Env, head ast.Node, args []ast.Node) packet {
+func specialEval(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
 	checkSpecialArgs("eval", head, args, 1, 2)
 
-	node := trampoline(func() packet {
-		return evalNode(e, args[0])
-	})
-
-	switch len(args) {
-	case 1:
-		return bounce(func() packet {
-			return evalNode(e, node)
-		})
-	case 2:
-		nodeArg1 := trampoline(func() packet {
-			return evalNode(e, args[1])
-		})
-
-		switch environmentNode := nodeArg1.(type) {
-		case *EnvNode:
+	return evalNode(th, e, args[0], then(th, func(th *thread, node ast.Node) packet {
+		switch len(args) {
+		case 1:
 			return bounce(func() packet {
-				return evalNode(environmentNode.Env, node)
+				return evalNode(th, e, node, k)
 			})
+		case 2:
+			return evalNode(th, e, args[1], then(th, func(th *thread, nodeArg1 ast.Node) packet {
+				switch environmentNode := nodeArg1.(type) {
+				case *EnvNode:
+					return bounce(func() packet {
+						return evalNode(th, environmentNode.Env, node, k)
+					})
+				default:
+					panicEvalError(args[0], "Second arg to 'eval' must be an environment: "+environmentNode.String())
+					return respond(nil)
+				}
+			}))
 		default:
-			panicEvalError(args[0], "Second arg to 'eval' must be an environment: "+environmentNode.String())
+			panicEvalError(args[0], "Unexpected number of args")
 			return respond(nil)
 		}
-	default:
-		panicEvalError(args[0], "Unexpected number of args")
-		return respond(nil)
-	}
+	}))
 }
 
-func specialFn(e Env, head ast.Node, args []ast.Node) packet {
+// specialFn is passed the whole proc form rather than its head, so that the
+// procedure can record where it was defined.
+func specialFn(th *thread, e Env, form ast.Node, args []ast.Node, k *continuation) packet {
+	return resume(k, newProcedure(e, form, args))
+}
 
+// newProcedure creates the procedure defined by a proc form with the given
+// arguments, closing over an environment.
+func newProcedure(e Env, form ast.Node, args []ast.Node) *Procedure {
 	var parameterNodes ast.Nodes
 	switch val := args[0].(type) {
 	case ast.Coll:
 		parameterNodes = val.Children()
 	default:
-		panicEvalError(head, "Expected list as first argument to 'proc': "+val.String())
+		panicEvalError(form, "Expected list as first argument to 'proc': "+val.String())
 	}
 
-	return respond(&Procedure{
+	return &Procedure{
 		Name:       "anonymous",
 		Parameters: parameterNodes,
 		Body:       args[1],
 		ParentEnv:  e,
-	})
+		Location:   form.Loc(),
+	}
 }
 
-func specialMacro(e Env, head ast.Node, args []ast.Node) packet {
+// specialCaseProc creates a procedure with several arities from clauses of
+// the form (params body). A call runs the first clause which accepts the
+// number of arguments given.
+func specialCaseProc(th *thread, e Env, form ast.Node, args []ast.Node, k *continuation) packet {
+	return resume(k, newCaseProcedure(e, form, args))
+}
 
-	procedureNode := trampoline(func() packet {
-		return evalNode(e, args[0])
-	})
+// newCaseProcedure creates the procedure defined by a case-proc form with the
+// given arguments, closing over an environment.
+func newCaseProcedure(e Env, form ast.Node, args []ast.Node) *Procedure {
+	clauses := make([]*Procedure, len(args))
+	for i, arg := range args {
+		clause, ok := arg.(*ast.List)
+		if !ok || len(clause.Nodes) != 2 {
+			panicEvalError(form, "Expected (params body) clause in 'case-proc': "+arg.String())
+		}
+		params, ok := clause.Nodes[0].(ast.Coll)
+		if !ok {
+			panicEvalError(form, "Expected list of parameters in 'case-proc' clause: "+clause.String())
+		}
 
-	switch val := procedureNode.(type) {
-	case *Procedure:
-		val.IsMacro = true
-		return respond(val)
-	default:
-		panicEvalError(args[0], "macro expects a procedure argument but got: "+args[0].String())
-		return respond(nil)
+		clauses[i] = &Procedure{
+			Name:       "anonymous",
+			Parameters: params.Children(),
+			Body:       clause.Nodes[1],
+			ParentEnv:  e,
+			Location:   clause.Loc(),
+		}
+	}
+
+	return &Procedure{
+		Name:      "anonymous",
+		ParentEnv: e,
+		Location:  form.Loc(),
+		Clauses:   clauses,
 	}
 }
 
-func specialMacroexpand1(e Env, head ast.Node, args []ast.Node) packet {
+func specialMacro(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+
+	return evalNode(th, e, args[0], then(th, func(th *thread, procedureNode ast.Node) packet {
+		switch val := procedureNode.(type) {
+		case *Procedure:
+			val.IsMacro = true
+			return resume(k, val)
+		default:
+			panicEvalError(args[0], "macro expects a procedure argument but got: "+args[0].String())
+			return respond(nil)
+		}
+	}))
+}
+
+func specialMacroexpand1(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
 
-	expansionNode := trampoline(func() packet {
-		return evalNode(e, args[0])
+	return evalNode(th, e, args[0], then(th, func(th *thread, expansionNode ast.Node) packet {
+		switch value := expansionNode.(type) {
+		case *ast.List:
+			return bounce(func() packet {
+				return evalList(th, e, value, false, k)
+			})
+		default:
+			panicEvalError(args[0], "macroexpand1 expected a list but got: "+value.String())
+			return respond(nil)
+		}
+	}))
+}
+
+// specialCallCC calls its routine argument with the current continuation,
+// reified as a routine of at most one argument. Invoking that routine
+// abandons whatever computation is in progress and instead returns its
+// argument from the original call/cc form, however many times it is invoked.
+func specialCallCC(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+
+	return evalNode(th, e, args[0], then(th, func(th *thread, routineNode ast.Node) packet {
+		switch val := routineNode.(type) {
+		case Routine:
+			return applyRoutine(th, e, val, head, ast.Nodes{newContinuation(th, k)}, k)
+		default:
+			panicEvalError(args[0], "call/cc expects a routine argument but got: "+routineNode.String())
+			return respond(nil)
+		}
+	}))
+}
+
+// specialTry evaluates its body forms in order. If an error is raised while
+// doing so, and the form has a (catch name forms...) clause, the error is
+// bound to the name and the catch forms are evaluated instead. The forms of a
+// (finally forms...) clause are always evaluated last, whether or not an error
+// was raised or caught.
+func specialTry(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	body, catchClause, finallyClause := splitTryClauses(head, args)
+
+	outerState := th.dynamicState
+
+	runFinally := func(th *thread, next func(th *thread) packet) packet {
+		if finallyClause == nil {
+			return next(th)
+		}
+		return evalSequence(th, e, finallyClause.Nodes[1:], then(th, func(th *thread, _ ast.Node) packet {
+			return next(th)
+		}))
+	}
+
+	finish := then(th, func(th *thread, result ast.Node) packet {
+		th.dynamicState = outerState
+		return runFinally(th, func(th *thread) packet {
+			return resume(k, result)
+		})
 	})
 
-	switch value := expansionNode.(type) {
-	case *ast.List:
-		expansionResult := trampoline(func() packet {
-			return evalList(e, value, false)
+	reraiseAfterFinally := func(th *thread, err *EvalError) packet {
+		return runFinally(th, func(th *thread) packet {
+			return raise(err)
 		})
-		return respond(expansionResult)
-	default:
-		panicEvalError(args[0], "macroexpand1 expected a list but got: "+value.String())
-		return respond(nil)
 	}
+
+	pushErrorHandler(th, func(th *thread, err *EvalError) packet {
+		// Unwind to the dynamic state outside of the try form
+		th.dynamicState = outerState
+
+		if catchClause == nil {
+			return reraiseAfterFinally(th, err)
+		}
+
+		errorName := toSymbol(catchClause.Nodes[1])
+		catchEnv := NewMapEnv("catch", e)
+		catchEnv.Set(errorName, NewErrorNode(err))
+
+		if finallyClause != nil {
+			// The finally clause must also run if the catch clause raises an error
+			pushErrorHandler(th, reraiseAfterFinally)
+		}
+
+		return evalSequence(th, catchEnv, catchClause.Nodes[2:], finish)
+	})
+
+	return evalSequence(th, e, body, finish)
+}
+
+// splitTryClauses separates the body forms of a 'try' form from its optional
+// trailing catch and finally clauses.
+func splitTryClauses(head ast.Node, args []ast.Node) (body []ast.Node, catchClause *ast.List, finallyClause *ast.List) {
+	body = args
+
+	if clause, ok := tryClause(body, "finally"); ok {
+		finallyClause = clause
+		body = body[:len(body)-1]
+	}
+
+	if clause, ok := tryClause(body, "catch"); ok {
+		catchClause = clause
+		body = body[:len(body)-1]
+
+		if len(clause.Nodes) < 2 {
+			panicEvalError(head, "Catch clause expects a name for the error: "+clause.String())
+		}
+		if _, ok := clause.Nodes[1].(*ast.Symbol); !ok {
+			panicEvalError(head, "Catch clause expects a symbol as the name for the error: "+clause.Nodes[1].String())
+		}
+	}
+
+	return body, catchClause, finallyClause
+}
+
+// tryClause returns the last of the nodes if it is a list starting with the
+// given symbol.
+func tryClause(nodes []ast.Node, name string) (*ast.List, bool) {
+	if len(nodes) == 0 {
+		return nil, false
+	}
+
+	if clause, ok := nodes[len(nodes)-1].(*ast.List); ok && len(clause.Nodes) > 0 {
+		if isKeyword(clause.Nodes[0], name) {
+			return clause, true
+		}
+	}
+
+	return nil, false
+}
+
+// specialHandlerBind evaluates its body forms with a handler routine in place
+// for any error raised. Unlike the catch clause of 'try', the handler is
+// called without unwinding, so it can continue the computation by invoking a
+// restart. If the handler returns normally, the error is passed on to the
+// next handler out.
+func specialHandlerBind(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	outerState := th.dynamicState
+
+	return evalNode(th, e, args[0], then(th, func(th *thread, handlerNode ast.Node) packet {
+		handler, ok := handlerNode.(Routine)
+		if !ok {
+			panicEvalError(args[0], "handler-bind expects a routine as its handler but got: "+handlerNode.String())
+		}
+
+		pushErrorHandler(th, func(th *thread, err *EvalError) packet {
+			return applyRoutine(th, e, handler, head, ast.Nodes{NewErrorNode(err)}, then(th, func(th *thread, _ ast.Node) packet {
+				return raise(err)
+			}))
+		})
+
+		return evalSequence(th, e, args[1:], then(th, func(th *thread, result ast.Node) packet {
+			th.dynamicState = outerState
+			return resume(k, result)
+		}))
+	}))
+}
+
+// specialRestartCase evaluates an expression with restarts available. Each
+// restart is given as a clause of the form (name (params...) forms...). When
+// a restart is invoked, the forms of its clause are evaluated with the
+// parameters bound to the arguments, and their value is returned from the
+// restart-case form.
+func specialRestartCase(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	outerState := th.dynamicState
+
+	clauses := args[1:]
+	for i := len(clauses) - 1; i >= 0; i-- {
+		clause, ok := clauses[i].(*ast.List)
+		if !ok || len(clause.Nodes) < 2 {
+			panicEvalError(head, "Restart clause should be of the form (name (params...) forms...): "+clauses[i].String())
+		}
+		name := toSymbolValue(clause.Nodes[0])
+		parameters, ok := clause.Nodes[1].(ast.Coll)
+		if !ok {
+			panicEvalError(head, "Expected list of parameters in restart clause: "+clause.String())
+		}
+
+		body := append(ast.Nodes{ast.Intern("begin")}, clause.Nodes[2:]...)
+		restartProcedure := &Procedure{
+			Name:       name,
+			Parameters: parameters.Children(),
+			Body:       &ast.List{Nodes: body, Location: clause.Location},
+			ParentEnv:  e,
+		}
+
+		pushRestart(th, name, restartProcedure.Parameters, func(th *thread, head ast.Node, args []ast.Node) packet {
+			th.dynamicState = outerState
+			return applyRoutine(th, e, restartProcedure, head, args, k)
+		})
+	}
+
+	return evalNode(th, e, args[0], then(th, func(th *thread, result ast.Node) packet {
+		th.dynamicState = outerState
+		return resume(k, result)
+	}))
 }
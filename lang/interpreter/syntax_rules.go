@@ -0,0 +1,286 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/onlyafly/vamos/lang/ast"
+)
+
+////////// Syntax Rules
+
+const ellipsis = "..."
+
+// gensym returns a new symbol, with a name which the interpreter has not
+// returned before. The name contains a '#', which the reader does not allow
+// in symbols, so it cannot be the name of a symbol in the source either. The
+// symbol is not interned, since no other symbol can be the same as it.
+func (in *Interpreter) gensym(prefix string) *ast.Symbol {
+	n := in.gensymCount.Add(1)
+	return &ast.Symbol{Name: fmt.Sprintf("%v#%v", prefix, n)}
+}
+
+// A syntaxRule rewrites forms which match its pattern into its template.
+type syntaxRule struct {
+	pattern  *ast.List
+	template ast.Node
+}
+
+// syntaxRules is a hygienic macro transformer. Symbols in the template of a
+// rule, other than its pattern variables, are renamed in each expansion, so
+// that the names the expansion binds cannot capture those of the caller, and
+// the names it refers to are looked up in the environment of the definition.
+type syntaxRules struct {
+	literals map[string]bool
+	rules    []syntaxRule
+	env      Env
+}
+
+// specialSyntaxRules creates a hygienic macro from a list of literals and
+// clauses of the form (pattern template).
+func specialSyntaxRules(th *thread, e Env, head ast.Node, args []ast.Node, k *continuation) packet {
+	sr := &syntaxRules{
+		literals: make(map[string]bool),
+		env:      e,
+	}
+
+	literals, ok := args[0].(*ast.List)
+	if !ok {
+		panicEvalError(head, "Expected list of literals as first argument to 'syntax-rules': "+args[0].String())
+	}
+	for _, literal := range literals.Nodes {
+		sr.literals[toSymbolName(literal)] = true
+	}
+
+	for _, clause := range args[1:] {
+		l, ok := clause.(*ast.List)
+		if !ok || len(l.Nodes) != 2 {
+			panicEvalError(head, "Expected (pattern template) clause in 'syntax-rules': "+clause.String())
+		}
+		pattern, ok := l.Nodes[0].(*ast.List)
+		if !ok || len(pattern.Nodes) == 0 {
+			panicEvalError(head, "Expected non-empty list as pattern in 'syntax-rules': "+l.Nodes[0].String())
+		}
+		sr.rules = append(sr.rules, syntaxRule{pattern: pattern, template: l.Nodes[1]})
+	}
+
+	// The macro is an ordinary macro procedure, which hands its arguments to the
+	// transformer
+	expanderEnv := NewMapEnv("syntax-rules", e)
+	expanderEnv.Set(ast.Intern("expand"), NewPrimitive("syntax-rules", 1, 1, sr.expand))
+
+	return resume(k, &Procedure{
+		Name:       "anonymous",
+		Parameters: ast.Nodes{ast.Intern("&rest"), ast.Intern("form")},
+		Body:       ast.NewList([]ast.Node{ast.Intern("expand"), ast.Intern("form")}),
+		ParentEnv:  expanderEnv,
+		IsMacro:    true,
+		Location:   locate(head, th.form),
+	})
+}
+
+// expand rewrites the arguments of a macro call using the first rule whose
+// pattern matches them. The head of a pattern is ignored.
+func (sr *syntaxRules) expand(in *Interpreter, e Env, head ast.Node, args []ast.Node) ast.Node {
+	form := args[0].(*ast.List)
+
+	for _, rule := range sr.rules {
+		bindings := make(map[string]*patternBinding)
+		if sr.matchList(rule.pattern.Nodes[1:], form.Nodes, bindings) {
+			renames := make(map[string]*ast.Symbol)
+			return sr.instantiate(in, rule.template, bindings, renames)
+		}
+	}
+
+	// The arguments are the nearest thing to the call site with a location
+	var at ast.Node = head
+	if len(form.Nodes) > 0 {
+		at = form.Nodes[0]
+	}
+	panicEvalError(at, "No 'syntax-rules' pattern matches the arguments: "+form.String())
+	return nil
+}
+
+// A patternBinding is what a pattern variable matched: a single node, or, for
+// a variable followed by an ellipsis, one binding for each repetition.
+type patternBinding struct {
+	node     ast.Node
+	repeated []*patternBinding
+}
+
+func (sr *syntaxRules) match(pattern ast.Node, n ast.Node, bindings map[string]*patternBinding) bool {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		switch {
+		case p.Name == "_":
+			return true
+		case sr.literals[p.Name]:
+			s, ok := n.(*ast.Symbol)
+			return ok && s.Base().Name == p.Base().Name
+		}
+		bindings[p.Name] = &patternBinding{node: n}
+		return true
+	case *ast.List:
+		switch val := n.(type) {
+		case *ast.List:
+			return sr.matchList(p.Nodes, val.Nodes, bindings)
+		case *ast.Nil:
+			return sr.matchList(p.Nodes, nil, bindings)
+		}
+		return false
+	}
+
+	return pattern.TypeName() == n.TypeName() && pattern.Equals(n)
+}
+
+// matchList matches the elements of a list against a list of patterns, one
+// of which may be followed by an ellipsis to match any number of elements.
+func (sr *syntaxRules) matchList(patterns []ast.Node, ns []ast.Node, bindings map[string]*patternBinding) bool {
+	for i, p := range patterns {
+		if i+1 < len(patterns) && isKeyword(patterns[i+1], ellipsis) {
+			after := patterns[i+2:]
+			repeatCount := len(ns) - i - len(after)
+			if repeatCount < 0 {
+				return false
+			}
+
+			repeated := make([]map[string]*patternBinding, repeatCount)
+			for j := range repeated {
+				repeated[j] = make(map[string]*patternBinding)
+				if !sr.match(p, ns[i+j], repeated[j]) {
+					return false
+				}
+			}
+			for _, name := range sr.patternVariables(p) {
+				b := &patternBinding{repeated: make([]*patternBinding, repeatCount)}
+				for j := range repeated {
+					b.repeated[j] = repeated[j][name]
+				}
+				bindings[name] = b
+			}
+
+			return sr.matchList(after, ns[i+repeatCount:], bindings)
+		}
+
+		if i >= len(ns) || !sr.match(p, ns[i], bindings) {
+			return false
+		}
+	}
+
+	return len(ns) == len(patterns)
+}
+
+// patternVariables lists the variables bound by a pattern.
+func (sr *syntaxRules) patternVariables(pattern ast.Node) []string {
+	switch p := pattern.(type) {
+	case *ast.Symbol:
+		if p.Name == "_" || p.Name == ellipsis || sr.literals[p.Name] {
+			return nil
+		}
+		return []string{p.Name}
+	case *ast.List:
+		var names []string
+		for _, child := range p.Nodes {
+			names = append(names, sr.patternVariables(child)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// instantiate builds the expansion described by a template. Each symbol which
+// is not a pattern variable is replaced by an alias, the same one for every
+// occurrence of the symbol in the expansion.
+func (sr *syntaxRules) instantiate(in *Interpreter, template ast.Node, bindings map[string]*patternBinding, renames map[string]*ast.Symbol) ast.Node {
+	switch t := template.(type) {
+	case *ast.Symbol:
+		if b, ok := bindings[t.Name]; ok {
+			if b.repeated != nil {
+				panicEvalError(t, "Pattern variable used without an ellipsis in 'syntax-rules' template: "+t.Name)
+			}
+			return b.node
+		}
+		if alias, ok := renames[t.Name]; ok {
+			return alias
+		}
+		alias := in.gensym(t.Base().Name)
+		alias.Location = t.Location
+		alias.Alias = &ast.Alias{Original: t, Scope: sr.env}
+		renames[t.Name] = alias
+		return alias
+	case *ast.List:
+		var elems []ast.Node
+		for i := 0; i < len(t.Nodes); i++ {
+			elem := t.Nodes[i]
+			if i+1 < len(t.Nodes) && isKeyword(t.Nodes[i+1], ellipsis) {
+				elems = append(elems, sr.instantiateRepeated(in, elem, bindings, renames)...)
+				i++
+				continue
+			}
+			elems = append(elems, sr.instantiate(in, elem, bindings, renames))
+		}
+		return ast.NewList(elems)
+	}
+
+	return template
+}
+
+// instantiateRepeated instantiates a template followed by an ellipsis once for
+// each repetition of the pattern variables in it.
+func (sr *syntaxRules) instantiateRepeated(in *Interpreter, template ast.Node, bindings map[string]*patternBinding, renames map[string]*ast.Symbol) []ast.Node {
+	repeatCount := -1
+	var names []string
+	for _, name := range sr.patternVariables(template) {
+		b, ok := bindings[name]
+		if !ok || b.repeated == nil {
+			continue
+		}
+		if repeatCount != -1 && len(b.repeated) != repeatCount {
+			panicEvalError(template, "Pattern variables followed by the same ellipsis matched different numbers of forms: "+template.String())
+		}
+		repeatCount = len(b.repeated)
+		names = append(names, name)
+	}
+
+	if repeatCount == -1 {
+		panicEvalError(template, "No pattern variable to repeat before an ellipsis in 'syntax-rules' template: "+template.String())
+	}
+
+	elems := make([]ast.Node, repeatCount)
+	for j := range elems {
+		inner := make(map[string]*patternBinding, len(bindings))
+		for name, b := range bindings {
+			inner[name] = b
+		}
+		for _, name := range names {
+			inner[name] = bindings[name].repeated[j]
+		}
+		elems[j] = sr.instantiate(in, template, inner, renames)
+	}
+	return elems
+}
+
+// stripAliases returns the node with any symbols renamed by a hygienic macro
+// restored to the symbols they stand for, so that quoted data in an expansion
+// reads as it was written in the template.
+func stripAliases(n ast.Node) ast.Node {
+	switch val := n.(type) {
+	case *ast.Symbol:
+		return val.Base()
+	case *ast.List:
+		var stripped []ast.Node
+		for i, child := range val.Nodes {
+			s := stripAliases(child)
+			if s != child && stripped == nil {
+				stripped = make([]ast.Node, len(val.Nodes))
+				copy(stripped, val.Nodes[:i])
+			}
+			if stripped != nil {
+				stripped[i] = s
+			}
+		}
+		if stripped != nil {
+			return &ast.List{Nodes: stripped, Location: val.Location, Locations: val.Locations}
+		}
+	}
+	return n
+}
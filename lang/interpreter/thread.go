@@ -0,0 +1,103 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Thread
+
+// A thread is a single line of execution of Vamos code, such as a top-level
+// evaluation or the body of a 'go' form. It holds the dynamic state of that
+// execution, which the trampoline consults when an error is raised.
+type thread struct {
+	dynamicState
+	interp    *Interpreter
+	frames    *procedureCall // The procedure calls in progress, innermost first
+	form      *ast.List      // The innermost form known to be being evaluated, in which its symbols are located
+	generator *generator     // The generator whose body the thread is running, if any
+	limits    *evalLimits    // The limits of the evaluation the thread runs on behalf of, if any
+	limiter   *limiter       // What stops the thread before it finishes, if anything
+	maxDepth  int            // The most frames the thread may have, or negative for no limit
+	baseDepth int            // The depth of the thread the thread is nested in, if any, counting the nesting as a frame
+}
+
+func newThread(in *Interpreter) *thread {
+	return &thread{interp: in, maxDepth: DefaultMaxDepth}
+}
+
+// An origin is what a thread which runs Vamos code for Go code, such as the
+// Go code which realizes a lazy sequence, takes from the thread which created
+// the Go code: the dynamic bindings, the form being evaluated, the limits and
+// the depth.
+type origin struct {
+	interp   *Interpreter
+	bindings *dynamicBinding
+	form     *ast.List
+	limits   *evalLimits
+	depth    int
+}
+
+func originOf(th *thread) origin {
+	return origin{interp: th.interp, bindings: th.bindings, form: th.form, limits: th.limits, depth: th.depth()}
+}
+
+// depth returns how many frames the thread has, including those of the
+// threads it is nested in.
+func (th *thread) depth() int {
+	if th.frames != nil {
+		return th.frames.depth
+	}
+	return th.baseDepth
+}
+
+// dynamicState is the part of a thread's state which follows the dynamic
+// extent of forms such as 'try', 'restart-case' and 'binding'. It is captured
+// along with continuations and reinstated when they are resumed.
+type dynamicState struct {
+	handlers *errorHandler
+	restarts *Restart
+	bindings *dynamicBinding
+}
+
+////////// Error Handlers
+
+// An errorHandler is installed by a 'try' or 'handler-bind' form for the
+// dynamic extent of its body. When an evaluation error is raised, the
+// trampoline removes the innermost handler and continues with the packet it
+// returns.
+type errorHandler struct {
+	handle func(*thread, *EvalError) packet
+	parent *errorHandler
+}
+
+func pushErrorHandler(th *thread, handle func(*thread, *EvalError) packet) {
+	th.handlers = &errorHandler{
+		handle: handle,
+		parent: th.handlers,
+	}
+}
+
+// raise hands an evaluation error to the innermost error handler, or escapes
+// evaluation altogether if there is none.
+func raise(err *EvalError) packet {
+	panic(err)
+}
+
+////////// Helpers
+
+// evalSequence evaluates the nodes in order and passes the value of the last
+// one to k, or nil if there are none. The last node is evaluated in tail
+// position.
+func evalSequence(th *thread, e Env, ns []ast.Node, k *continuation) packet {
+	switch len(ns) {
+	case 0:
+		return resume(k, &ast.Nil{})
+	case 1:
+		return evalNode(th, e, ns[0], k)
+	}
+
+	if _, ok := evalSimple(th, e, ns[0]); ok {
+		return evalSequence(th, e, ns[1:], k)
+	}
+	return evalNode(th, e, ns[0], then(th, func(th *thread, _ ast.Node) packet {
+		return evalSequence(th, e, ns[1:], k)
+	}))
+}
@@ -1,14 +1,61 @@
 package interpreter
 
-import "github.com/onlyafly/vamos/lang/ast"
+import (
+	"sync/atomic"
+
+	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/token"
+)
+
+// A continuation represents the rest of a computation. Its function accepts
+// the value produced by the current computation and returns the packet that
+// carries on from there. The thread is passed in rather than captured, because
+// a continuation may be resumed by a different thread than the one which
+// created it.
+//
+// A continuation also remembers the procedure calls which were in progress
+// when it was created, and reinstates them when it is resumed. A procedure
+// called with a continuation is therefore only ever one frame deeper than the
+// call stack it returns to, which keeps tail calls from growing the stack. The
+// form which was being evaluated is reinstated in the same way.
+type continuation struct {
+	fn      func(*thread, ast.Node) packet
+	frames  *procedureCall
+	form    *ast.List
+	resumed atomic.Bool
+}
+
+// then creates a continuation which returns to the current call stack of the
+// thread.
+func then(th *thread, fn func(*thread, ast.Node) packet) *continuation {
+	return &continuation{fn: fn, frames: th.frames, form: th.form}
+}
+
+// firstResume reports whether the continuation is being resumed for the first
+// time. A continuation captured by call/cc may be resumed again, so only the
+// first resumption may reuse state which the continuation shares with the
+// computation that created it.
+func (k *continuation) firstResume() bool {
+	return !k.resumed.Swap(true)
+}
 
 // A packet represents the continuation of a sequence of computations.
-// It contains either a Next or a Node, but not both.
+// It contains either a Next, a Body to evaluate, a Node to pass to a
+// Continuation, or a final Node.
 // If it contains a Next, the thunk is the next computation to execute.
-// If it contains a Node, the trampolining session is over and the Node represents the result.
+// If it contains a Body, the body of that procedure is evaluated in Env and
+// its value handed to the Continuation. This is how every procedure call
+// begins, and saves creating a thunk for each.
+// If it contains only a Continuation, the Node is handed to it as the next
+// computation.
+// Otherwise, the trampolining session is over and the Node represents the
+// result.
 type packet struct {
-	Next   thunk
-	Result ast.Node
+	Next         thunk
+	Body         *Procedure
+	Env          Env
+	Continuation *continuation
+	Result       ast.Node
 }
 
 // Bounce continues the trampolining session by placing a new thunk in the chain.
@@ -16,26 +63,105 @@ func bounce(t thunk) packet {
 	return packet{Next: t}
 }
 
+// startBody continues the trampolining session by evaluating the body of a
+// procedure in an environment, handing its value to k.
+func startBody(f *Procedure, e Env, k *continuation) packet {
+	return packet{Body: f, Env: e, Continuation: k}
+}
+
+// Resume continues the trampolining session by handing a ast.Node to a
+// continuation. The continuation is invoked by the trampoline rather than
+// directly, so that returning a value never grows the Go stack.
+func resume(k *continuation, n ast.Node) packet {
+	return packet{Continuation: k, Result: n}
+}
+
 // Respond exits a trampolining session by placing a ast.Node on the end of the
 // chain.
 func respond(n ast.Node) packet {
 	return packet{Result: n}
 }
 
+// endContinuation is the outermost continuation of every trampolining
+// session.
+var endContinuation = &continuation{
+	fn: func(th *thread, n ast.Node) packet {
+		return respond(n)
+	},
+}
+
 type thunk func() packet
 
 // Trampoline iteratively calls a chain of thunks until there is no next thunk,
 // at which point it pulls the resulting ast.Node out of the packet and returns it.
-func trampoline(currentThunk thunk) ast.Node {
-	for currentThunk != nil {
-		nextPacket := currentThunk()
-
-		if nextPacket.Next != nil {
-			currentThunk = nextPacket.Next
-		} else {
-			return nextPacket.Result
+// Evaluation errors raised along the way are passed to the innermost error
+// handler of the thread, if there is one.
+func trampoline(th *thread, currentThunk thunk) ast.Node {
+	nextPacket := bounce(currentThunk)
+
+	for {
+		result, finished := trampolineUntilError(th, &nextPacket)
+		if finished {
+			return result
 		}
 	}
+}
+
+// trampolineUntilError runs the chain of thunks until it either finishes or an
+// evaluation error is handed to an error handler. In the latter case, the
+// packet is replaced with the handler's packet.
+func trampolineUntilError(th *thread, p *packet) (result ast.Node, finished bool) {
+	defer func() {
+		if e := recover(); e != nil {
+			if e == ast.ErrSelfDependent {
+				// A lazy sequence was needed while it was being realized
+				var loc *token.Location
+				if th.form != nil {
+					loc = th.form.Location
+				}
+				e = NewEvalError("Evaluation error", ast.ErrSelfDependent.Error(), loc)
+			}
+			err, ok := e.(*EvalError)
+			if !ok {
+				panic(e)
+			}
+			if err.location == nil && err.node != nil {
+				err.location = locate(err.node, th.form)
+			}
+			if !err.raised {
+				err.raised = true
+				err.calls = th.frames
+			}
+			if th.handlers == nil {
+				// The error escapes evaluation, taking with it the restarts which
+				// could be used to continue
+				err.Restarts = availableRestarts(th)
+				panic(err)
+			}
 
-	return nil
+			h := th.handlers
+			th.handlers = h.parent
+			*p = bounce(func() packet {
+				return h.handle(th, err)
+			})
+		}
+	}()
+
+	for {
+		if th.limiter != nil {
+			th.limiter.step()
+		}
+
+		switch {
+		case p.Next != nil:
+			*p = p.Next()
+		case p.Body != nil:
+			*p = evalBody(th, p.Env, p.Body, p.Continuation)
+		case p.Continuation != nil:
+			th.frames, th.form = p.Continuation.frames, p.Continuation.form
+			*p = p.Continuation.fn(th, p.Result)
+		default:
+			return p.Result, true
+		}
+	}
 }
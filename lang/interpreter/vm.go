@@ -0,0 +1,166 @@
+package interpreter
+
+import "github.com/onlyafly/vamos/lang/ast"
+
+////////// Virtual Machine
+
+func newOperandStack(c *code) []ast.Node {
+	return make([]ast.Node, 0, c.maxStack)
+}
+
+// execute runs code from instruction pc, with the given environment and
+// operand stack, until it returns a value to k or needs the trampoline to
+// carry on, such as for a procedure call. A call which is not in tail position
+// is given a continuation which resumes the code after the call.
+func execute(th *thread, c *code, k *continuation, pc int, e Env, stack []ast.Node) packet {
+	for {
+		in := c.instructions[pc]
+		pc++
+
+		switch in.op {
+		case opConst:
+			stack = append(stack, c.constants[in.a])
+		case opNil:
+			stack = append(stack, &ast.Nil{})
+		case opLoad:
+			symbol := c.constants[in.a].(*ast.Symbol)
+			value, ok := lookupPast(e, symbol, in.b)
+			if !ok {
+				return signalUndefinedName(th, e, symbol, continueAt(th, c, k, pc, e, stack))
+			}
+			if dv, ok := value.(*DynamicVar); ok {
+				value = dynamicValue(th, dv)
+			}
+			stack = append(stack, value)
+		case opLoadLocal:
+			value := loadLocal(e, c.constants[in.a].(*ast.Symbol), in.b, in.c)
+			if value == nil {
+				// The slot has not been set yet, so the name is looked up as the
+				// evaluator would
+				var ok bool
+				symbol := c.constants[in.a].(*ast.Symbol)
+				if value, ok = lookupSymbol(e, symbol); !ok {
+					return signalUndefinedName(th, e, symbol, continueAt(th, c, k, pc, e, stack))
+				}
+			}
+			if dv, ok := value.(*DynamicVar); ok {
+				value = dynamicValue(th, dv)
+			}
+			stack = append(stack, value)
+		case opPop:
+			stack = stack[:len(stack)-1]
+		case opJump:
+			pc = in.a
+		case opJumpIfFalse:
+			value := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !toBooleanValue(value) {
+				pc = in.a
+			}
+		case opDef:
+			form := c.constants[in.a].(*ast.List)
+			defineName(e, form.Nodes[0], toSymbol(form.Nodes[1]), stack[len(stack)-1])
+			stack[len(stack)-1] = &ast.Nil{}
+		case opUpdate:
+			form := c.constants[in.a].(*ast.List)
+			updateName(th, e, form.Nodes[0], form.Nodes[1].(*ast.Symbol), stack[len(stack)-1])
+			stack[len(stack)-1] = &ast.Nil{}
+		case opProc:
+			form := c.constants[in.a].(*ast.List)
+			f := newProcedure(e, form, form.Nodes[1:])
+			if in.b >= 0 {
+				c.procedures[in.b].attach(f)
+			}
+			stack = append(stack, f)
+		case opCaseProc:
+			form := c.constants[in.a].(*ast.List)
+			f := newCaseProcedure(e, form, form.Nodes[1:])
+			if in.b >= 0 {
+				for i, clause := range f.Clauses {
+					c.procedures[in.b+i].attach(clause)
+				}
+			}
+			stack = append(stack, f)
+		case opEnterLet:
+			e = NewFrameEnv("let", c.layouts[in.a], e)
+		case opLeaveLet:
+			e = e.Parent()
+		case opCheckPattern:
+			pattern := c.constants[in.a]
+			checkPattern("Let variables", pattern, pattern)
+		case opBind:
+			bindPattern(e, c.constants[in.a], stack[len(stack)-1])
+			stack = stack[:len(stack)-1]
+		case opCondFailed:
+			head := c.constants[in.a].(*ast.List).Nodes[0]
+			panicEvalError(head, "No matching cond clause: "+head.String())
+		case opPrepareCall:
+			form := c.constants[in.a].(*ast.List)
+			head := form.Nodes[0]
+			r, ok := stack[len(stack)-1].(Routine)
+			if !ok {
+				panicEvalError(head, "First item in list not a routine: "+stack[len(stack)-1].String())
+			}
+			if f, ok := r.(*Procedure); ok && f.IsMacro {
+				stack = stack[:len(stack)-1]
+				if in.b < 0 {
+					return evalMacroCall(th, e, f, form, k)
+				}
+				return evalMacroCall(th, e, f, form, continueAt(th, c, k, in.b, e, stack))
+			}
+			checkRoutineArgs(r, head, form.Nodes[1:])
+		case opCall, opTailCall:
+			form := c.constants[in.a].(*ast.List)
+			head := form.Nodes[0]
+			argCount := len(form.Nodes) - 1
+
+			args := make(ast.Nodes, argCount)
+			copy(args, stack[len(stack)-argCount:])
+			r := stack[len(stack)-argCount-1].(Routine)
+			stack = stack[:len(stack)-argCount-1]
+
+			if p, ok := r.(*Primitive); ok && p.Control == nil {
+				// Simple primitives are called straight away
+				value := p.Value(th.interp, e, head, args)
+				if in.op == opTailCall {
+					return resume(k, value)
+				}
+				stack = append(stack, value)
+				continue
+			}
+
+			if in.op == opTailCall {
+				th.form = form
+				return invokeRoutine(th, e, r, head, args, true, k)
+			}
+			next := continueAt(th, c, k, pc, e, stack)
+			th.form = form
+			return invokeRoutine(th, e, r, head, args, true, next)
+		case opEval:
+			return evalNode(th, e, c.constants[in.a], continueAt(th, c, k, pc, e, stack))
+		case opTailEval:
+			return evalNode(th, e, c.constants[in.a], k)
+		case opReturn:
+			return resume(k, stack[len(stack)-1])
+		}
+	}
+}
+
+// attach gives a procedure created by a proc form the parameter list and body
+// compiled for the form.
+func (cp *compiledProcedure) attach(f *Procedure) {
+	f.parsedParameters.Store(cp.params)
+	f.compiledBody.Store(cp.body)
+}
+
+// continueAt creates a continuation which pushes its value onto the operand
+// stack and carries on running code from instruction pc. The stack is copied
+// each time the continuation is resumed, since a continuation captured by
+// call/cc may be resumed more than once.
+func continueAt(th *thread, c *code, k *continuation, pc int, e Env, stack []ast.Node) *continuation {
+	return then(th, func(th *thread, value ast.Node) packet {
+		resumed := make([]ast.Node, len(stack), max(len(stack)+1, c.maxStack))
+		copy(resumed, stack)
+		return execute(th, c, k, pc, e, append(resumed, value))
+	})
+}
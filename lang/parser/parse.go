@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"github.com/onlyafly/vamos/lang/ast"
+	"github.com/onlyafly/vamos/lang/token"
 	"strconv"
 	"unicode/utf8"
 )
@@ -71,7 +72,14 @@ func (p *parser) inputEmpty() bool {
 func parseNodes(p *parser, errors *ParserErrorList) []ast.Node {
 	var nodes []ast.Node
 	for !p.inputEmpty() {
-		nodes = append(nodes, parseAnnotatedNode(p, errors))
+		loc := p.peek().Loc
+		node := parseAnnotatedNode(p, errors)
+		if s, ok := node.(*ast.Symbol); ok && s.Location == nil {
+			// There is no list to record where a symbol on its own was read, so
+			// it is given a copy of the symbol which records it
+			node = ast.NewSymbol(s.Name, loc)
+		}
+		nodes = append(nodes, node)
 	}
 	return nodes
 }
@@ -83,17 +91,7 @@ func parseAnnotatedNode(p *parser, errors *ParserErrorList) ast.AnnotatedNode {
 	case TcError:
 		errors.Add(token.Loc, "Error token: "+token.String())
 	case TcLeftParen:
-		var list []ast.Node
-		for p.peek().Code != TcRightParen {
-			if p.peek().Code == TcEOF || p.peek().Code == TcError {
-				errors.Add(token.Loc, "Unbalanced parentheses")
-				p.next()
-				return &ast.Nil{Location: token.Loc}
-			}
-			list = append(list, parseAnnotatedNode(p, errors))
-		}
-		p.next()
-		return &ast.List{Nodes: list, Location: token.Loc}
+		return parseList(p, token, errors)
 	case TcRightParen:
 		errors.Add(token.Loc, "Unbalanced parentheses")
 	case TcNumber:
@@ -107,7 +105,13 @@ func parseAnnotatedNode(p *parser, errors *ParserErrorList) ast.AnnotatedNode {
 	case TcCaret:
 		return parseAnnotation(p, errors)
 	case TcSingleQuote:
-		return parseQuote(p, errors)
+		return parseQuote(p, token, errors, "quote")
+	case TcBackquote:
+		return parseQuote(p, token, errors, "quasiquote")
+	case TcComma:
+		return parseQuote(p, token, errors, "unquote")
+	case TcCommaAt:
+		return parseQuote(p, token, errors, "unquote-splicing")
 	default:
 		errors.Add(token.Loc, "Unrecognized token: "+token.String())
 	}
@@ -115,18 +119,46 @@ func parseAnnotatedNode(p *parser, errors *ParserErrorList) ast.AnnotatedNode {
 	return &ast.Nil{Location: token.Loc}
 }
 
+// parseList reads the nodes of a list up to its closing parenthesis,
+// recording where each of them was read.
+func parseList(p *parser, t Token, errors *ParserErrorList) ast.AnnotatedNode {
+	var list []ast.Node
+	var locations []*token.Location
+	for p.peek().Code != TcRightParen {
+		if p.peek().Code == TcEOF || p.peek().Code == TcError {
+			errors.Add(t.Loc, "Unbalanced parentheses")
+			p.next()
+			return &ast.Nil{Location: t.Loc}
+		}
+		locations = append(locations, p.peek().Loc)
+		list = append(list, parseAnnotatedNode(p, errors))
+	}
+	p.next()
+	return &ast.List{Nodes: list, Location: t.Loc, Locations: locations}
+}
+
 func parseAnnotation(p *parser, errors *ParserErrorList) ast.AnnotatedNode {
 	annotation := parseAnnotatedNode(p, errors)
+	loc := p.peek().Loc
 	annotatee := parseAnnotatedNode(p, errors)
+	if s, ok := annotatee.(*ast.Symbol); ok {
+		// An interned symbol is shared, so the annotation is given to a copy
+		annotatee = ast.NewSymbol(s.Name, loc)
+	}
 	annotatee.SetAnnotation(annotation)
 	return annotatee
 }
 
-func parseQuote(p *parser, errors *ParserErrorList) ast.AnnotatedNode {
+// parseQuote reads the node following a quoting character, such as ' or `,
+// and wraps it in a list headed by the named special form.
+func parseQuote(p *parser, t Token, errors *ParserErrorList, name string) ast.AnnotatedNode {
+	loc := p.peek().Loc
 	node := parseAnnotatedNode(p, errors)
-	var list []ast.Node
-	list = append(list, &ast.Symbol{Name: "quote"}, node)
-	return &ast.List{Nodes: list}
+	return &ast.List{
+		Nodes:     []ast.Node{ast.Intern(name), node},
+		Location:  t.Loc,
+		Locations: []*token.Location{t.Loc, loc},
+	}
 }
 
 func parseNumber(t Token, errors *ParserErrorList) *ast.Number {
@@ -144,7 +176,7 @@ func parseSymbol(t Token, errors *ParserErrorList) ast.AnnotatedNode {
 	if t.Value == "nil" {
 		return &ast.Nil{Location: t.Loc}
 	}
-	return &ast.Symbol{Name: t.Value, Location: t.Loc}
+	return ast.Intern(t.Value)
 }
 
 func parseString(t Token, errors *ParserErrorList) *ast.Str {
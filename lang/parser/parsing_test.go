@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"github.com/onlyafly/vamos/lang/ast"
 	"github.com/onlyafly/vamos/testhelp"
 	"testing"
 )
@@ -24,8 +25,43 @@ func TestParse(t *testing.T) {
 	testhelp.CheckEqualString(t, "((defproc init () (print 42)))", result.String())
 }
 
+func TestParse_SymbolsAreInterned(t *testing.T) {
+	result, _ := Parse("(f x x y)", "test")
+	list := result[0].(*ast.List)
+	x1, x2, y := list.Nodes[1].(*ast.Symbol), list.Nodes[2].(*ast.Symbol), list.Nodes[3].(*ast.Symbol)
+
+	if x1 != x2 || x1 != ast.Intern("x") {
+		t.Errorf("Expected every occurrence of a symbol to be the interned symbol")
+	}
+	if x1 == y || x1.Equals(y) {
+		t.Errorf("Expected symbols with different names not to be the same symbol")
+	}
+	testhelp.CheckEqualInt(t, 4, list.LocOf(1).Column)
+	testhelp.CheckEqualInt(t, 6, list.LocOf(2).Column)
+}
+
+func TestParse_SymbolOnItsOwn(t *testing.T) {
+	result, _ := Parse("\n  x", "test")
+	x := result[0].(*ast.Symbol)
+
+	if !x.Is(ast.Intern("x")) || !ast.Intern("x").Equals(x) {
+		t.Errorf("Expected a symbol on its own to be the same symbol as the interned one")
+	}
+	testhelp.CheckEqualInt(t, 2, x.Loc().Line)
+	testhelp.CheckEqualInt(t, 3, x.Loc().Column)
+}
+
 func TestParse_SymbolAnnotatingSymbol(t *testing.T) {
 	result, _ := Parse("(defproc ^sample init ()  (print 42))", "test")
 
 	testhelp.CheckEqualString(t, "((defproc ^sample init () (print 42)))", result.String())
+	if ast.Intern("init").Annotation() != nil {
+		t.Errorf("Expected the annotation not to be given to the interned symbol")
+	}
+}
+
+func TestParse_Quasiquote(t *testing.T) {
+	result, _ := Parse("`(a ,b ,@c)", "test")
+
+	testhelp.CheckEqualString(t, "((quasiquote (a (unquote b) (unquote-splicing c))))", result.String())
 }
@@ -46,6 +46,9 @@ const (
 	TcEOF
 	TcString
 	TcChar
+	TcBackquote
+	TcComma
+	TcCommaAt
 )
 
 const eof = -1
@@ -81,13 +84,20 @@ func (s *Scanner) run() {
 
 func (s *Scanner) emit(code TokenCode) {
 	s.Tokens <- Token{
-		Loc:   &token.Location{Pos: s.start, Line: s.line, Filename: s.name},
+		Loc:   &token.Location{Pos: s.start, Line: s.line, Column: s.column(), Filename: s.name},
 		Code:  code,
 		Value: s.input[s.start:s.pos],
 	}
 	s.start = s.pos
 }
 
+// column returns the column of the start position of this item, counting
+// from 1.
+func (s *Scanner) column() int {
+	lineStart := strings.LastIndex(s.input[:s.start], "\n") + 1
+	return utf8.RuneCountInString(s.input[lineStart:s.start]) + 1
+}
+
 func (s *Scanner) next() (r rune) {
 	if s.pos >= len(s.input) {
 		s.width = 0
@@ -137,7 +147,7 @@ func (s *Scanner) acceptRun(valid string) {
 
 func (s *Scanner) emitErrorf(format string, args ...interface{}) {
 	t := Token{
-		Loc:   &token.Location{Pos: s.start, Line: s.line, Filename: s.name},
+		Loc:   &token.Location{Pos: s.start, Line: s.line, Column: s.column(), Filename: s.name},
 		Code:  TcError,
 		Value: s.input[s.start:s.pos],
 	}
@@ -197,6 +207,15 @@ Outer:
 			s.emit(TcCaret)
 		case r == '\'':
 			s.emit(TcSingleQuote)
+		case r == '`':
+			s.emit(TcBackquote)
+		case r == ',':
+			if s.peek() == '@' {
+				s.next()
+				s.emit(TcCommaAt)
+			} else {
+				s.emit(TcComma)
+			}
 		case r == '\\':
 			return scanChar
 		case r == ';':
@@ -36,3 +36,17 @@ func TestScan(t *testing.T) {
 	testhelp.CheckEqualStringer(t, ")", <-tokens)
 	fmt.Printf("END\n")
 }
+
+func TestScan_Quasiquote(t *testing.T) {
+	_, tokens := Scan("tester1", "`(a ,b ,@c)")
+
+	testhelp.CheckEqualStringer(t, "`", <-tokens)
+	testhelp.CheckEqualStringer(t, "(", <-tokens)
+	testhelp.CheckEqualStringer(t, "a", <-tokens)
+	testhelp.CheckEqualStringer(t, ",", <-tokens)
+	testhelp.CheckEqualStringer(t, "b", <-tokens)
+	testhelp.CheckEqualStringer(t, ",@", <-tokens)
+	testhelp.CheckEqualStringer(t, "c", <-tokens)
+	testhelp.CheckEqualStringer(t, ")", <-tokens)
+	testhelp.CheckEqualStringer(t, "EOF", <-tokens)
+}
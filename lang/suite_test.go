@@ -2,6 +2,7 @@ package lang
 
 import (
 	"bytes"
+	"context"
 	"github.com/onlyafly/vamos/lang/ast"
 	"github.com/onlyafly/vamos/lang/interpreter"
 	"github.com/onlyafly/vamos/lang/parser"
@@ -9,21 +10,50 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
 const (
 	testsuiteDir = "testsuite"
 	baseDir      = ".."
+
+	// suiteMaxDepth is lower than the default, so that the cases which recurse
+	// without end stop quickly
+	suiteMaxDepth = 10000
 )
 
+// enterBaseDir sets the base directory so that the test cases can use paths
+// that make sense. If this is not set, the current working directory while the
+// tests run will be "lang"
+var enterBaseDir = sync.OnceFunc(func() {
+	os.Chdir(baseDir)
+})
+
 func TestFullSuite(t *testing.T) {
 
-	// We set the base directory so that the test cases can use paths that make
-	// sense. If this is not set, the current working directory while the tests
-	// run will be "lang"
-	os.Chdir(baseDir)
+	enterBaseDir()
+
+	testSuiteFiles(t, interpreter.TreeWalker)
+}
+
+// TestFullSuiteBytecodeVM runs the suite again with the bytecode virtual
+// machine, which must give the same results as the tree-walking evaluator.
+func TestFullSuiteBytecodeVM(t *testing.T) {
+	enterBaseDir()
 
+	testSuiteFiles(t, interpreter.BytecodeVM)
+}
+
+// TestFullSuiteClosureCompiler runs the suite again with the closure
+// compiler, which must give the same results as the tree-walking evaluator.
+func TestFullSuiteClosureCompiler(t *testing.T) {
+	enterBaseDir()
+
+	testSuiteFiles(t, interpreter.ClosureCompiler)
+}
+
+func testSuiteFiles(t *testing.T, engine interpreter.Engine) {
 	filepath.Walk(testsuiteDir, func(fp string, fi os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Can't visit this node, but continue walking elsewhere
@@ -39,14 +69,14 @@ func TestFullSuite(t *testing.T) {
 		}
 
 		if matched {
-			testInputFile(fp, t)
+			testInputFile(fp, engine, t)
 		}
 
 		return nil
 	})
 }
 
-func testInputFile(sourceFilePath string, t *testing.T) {
+func testInputFile(sourceFilePath string, engine interpreter.Engine, t *testing.T) {
 	sourceDirPart, sourceFileNamePart := filepath.Split(sourceFilePath)
 	parts := strings.Split(sourceFileNamePart, ".")
 	testName := parts[0]
@@ -55,13 +85,13 @@ func testInputFile(sourceFilePath string, t *testing.T) {
 
 	input, errIn := util.ReadFile(sourceFilePath)
 	if errIn != nil {
-		t.Errorf("Error reading file <" + sourceFilePath + ">: " + errIn.Error())
+		t.Errorf("Error reading file <%v>: %v", sourceFilePath, errIn.Error())
 		return
 	}
 
 	expectedRaw, errOut := util.ReadFile(outputFilePath)
 	if errOut != nil {
-		t.Errorf("Error reading file <" + outputFilePath + ">: " + errOut.Error())
+		t.Errorf("Error reading file <%v>: %v", outputFilePath, errOut.Error())
 		return
 	}
 
@@ -73,18 +103,19 @@ func testInputFile(sourceFilePath string, t *testing.T) {
 	if errors.Len() != 0 {
 		verify(t, sourceFilePath, input, expected, errors.String())
 	} else {
-		e := interpreter.NewTopLevelMapEnv()
-
 		var outputBuffer bytes.Buffer
 
 		dummyReadLine := func() string {
 			return "text from dummy read line"
 		}
 
+		in := interpreter.New(&outputBuffer, dummyReadLine)
+		in.Engine = engine
+
 		var result ast.Node
 		var evalError error
 		for _, n := range nodes {
-			result, evalError = interpreter.Eval(e, n, &outputBuffer, dummyReadLine)
+			result, evalError = in.EvalContext(context.Background(), n, interpreter.Limits{MaxDepth: suiteMaxDepth})
 			if evalError != nil {
 				break
 			}
@@ -3,5 +3,6 @@ package token
 type Location struct {
 	Pos      int // position within the file
 	Line     int
+	Column   int
 	Filename string
 }
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 
 	"github.com/onlyafly/vamos/util"
@@ -24,6 +27,9 @@ const (
 )
 
 var (
+	// The limits on each evaluation, which are set from the command line
+	limits interpreter.Limits
+
 	// TODO add functionality for these missing commands
 	commandCompletions = []string{":quit" /*":load ", ":reset", ":help",*/, ":inspect "}
 	// TODO wordCompletions    = []string{"def", "update!"}
@@ -89,6 +95,8 @@ func main() {
 
 	startupFileName := flag.String("l", "", "load a file at startup")
 	showHelp := flag.Bool("help", false, "show the help")
+	maxDepth := flag.Int("max-depth", interpreter.DefaultMaxDepth, "the most procedure calls which may be in progress at once, or -1 for no limit")
+	engine := flag.String("engine", "tree", "the engine to evaluate with: tree, bytecode or closure")
 	flag.Parse()
 	exeFileName := flag.Arg(0)
 
@@ -98,6 +106,19 @@ func main() {
 		return
 	}
 
+	var activeEngine interpreter.Engine
+	switch *engine {
+	case "tree":
+		activeEngine = interpreter.TreeWalker
+	case "bytecode":
+		activeEngine = interpreter.BytecodeVM
+	case "closure":
+		activeEngine = interpreter.ClosureCompiler
+	default:
+		fmt.Printf("Unknown engine: %v\n", *engine)
+		os.Exit(2)
+	}
+
 	// Setup liner
 
 	line := startLiner()
@@ -113,26 +134,32 @@ func main() {
 
 	// Initialize
 
-	topLevelEnv := interpreter.NewTopLevelMapEnv()
+	limits.MaxDepth = *maxDepth
+	in := interpreter.New(os.Stdout, standardReadLine)
+	in.Engine = activeEngine
 
 	if len(exeFileName) != 0 {
-		loadFile("prelude.v", topLevelEnv, standardReadLine)
-		loadFile(exeFileName, topLevelEnv, standardReadLine)
+		loadFile("prelude.v", in)
+		loadFile(exeFileName, in)
 		return
 	}
 
 	fmt.Printf("Vamos %s (%s)\n", version, versionDate)
-	loadFile("prelude.v", topLevelEnv, standardReadLine)
+	loadFile("prelude.v", in)
 	fmt.Printf("(Press Ctrl+C or type :quit to exit)\n\n")
 
 	// Loading of files
 
 	if startupFileName != nil {
-		loadFile(*startupFileName, topLevelEnv, standardReadLine)
+		loadFile(*startupFileName, in)
 	}
 
 	// REPL
 
+	prompt := func(text string) (string, error) {
+		return line.Prompt(text)
+	}
+
 	for {
 		input, err := line.Prompt("> ")
 
@@ -156,17 +183,115 @@ func main() {
 			return
 		case strings.HasPrefix(input, ":inspect "):
 			withoutInspectPrefix := strings.Split(input, ":inspect ")[1]
-			if result, err := interpreter.ParseEval(topLevelEnv, withoutInspectPrefix, standardReadLine, "REPL"); err == nil {
+			if result, err := parseEvalInterruptibly(in, withoutInspectPrefix); err == nil {
 				inspect(result)
 			} else {
-				fmt.Println(err.Error())
+				in.PrintError(err)
 			}
 		default:
-			interpreter.ParseEvalPrint(topLevelEnv, input, standardReadLine, "REPL", true)
+			result, err := parseEvalInterruptibly(in, input)
+			printOrRestart(result, err, in, prompt)
 		}
 	}
 }
 
+// parseEvalInterruptibly evaluates a REPL entry, which Ctrl+C interrupts
+// without ending the session. An entry waiting for something which cannot be
+// interrupted, such as a line of input, ends the session on a second Ctrl+C.
+func parseEvalInterruptibly(in *interpreter.Interpreter, input string) (ast.Node, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-finished:
+			return
+		}
+		select {
+		case <-interrupts:
+			fmt.Println()
+			os.Exit(130)
+		case <-finished:
+		}
+	}()
+
+	return in.ParseEvalContext(ctx, input, "REPL", limits)
+}
+
+// printOrRestart prints the result of evaluating a REPL entry. If evaluation
+// raised an error which can be continued, the user is offered the available
+// restarts.
+func printOrRestart(result ast.Node, err error, in *interpreter.Interpreter, prompt func(string) (string, error)) {
+	for err != nil {
+		in.PrintError(err)
+
+		evalErr, ok := err.(*interpreter.EvalError)
+		if !ok || len(evalErr.Restarts) == 0 {
+			return
+		}
+
+		restart := chooseRestart(evalErr.Restarts, prompt)
+		if restart == nil {
+			return
+		}
+
+		var args []ast.Node
+		for _, param := range restart.Parameters {
+			input, promptErr := prompt(fmt.Sprintf("%v> ", param))
+			if promptErr != nil {
+				return
+			}
+
+			arg, argErr := in.ParseEval(input, "REPL")
+			if argErr != nil {
+				in.PrintError(argErr)
+				return
+			}
+			if arg == nil {
+				arg = &ast.Nil{}
+			}
+			args = append(args, arg)
+		}
+
+		result, err = in.InvokeRestart(restart, args)
+	}
+
+	// Can be null if nothing was entered
+	if result != nil {
+		fmt.Println(result.String())
+	}
+}
+
+// chooseRestart lists the restarts and asks the user to pick one. It returns
+// nil if the user chooses to abort.
+func chooseRestart(restarts []*interpreter.Restart, prompt func(string) (string, error)) *interpreter.Restart {
+	fmt.Println("Restarts:")
+	for i, r := range restarts {
+		fmt.Printf("  %v: %v\n", i+1, r.String())
+	}
+	fmt.Printf("  %v: abort\n", len(restarts)+1)
+
+	input, err := prompt("Restart> ")
+	if err != nil {
+		return nil
+	}
+
+	choice, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || choice < 1 || choice > len(restarts) {
+		return nil
+	}
+
+	return restarts[choice-1]
+}
+
 func inspect(arg ast.Node) {
 	switch val := arg.(type) {
 	case *interpreter.EnvNode:
@@ -179,13 +304,15 @@ func inspect(arg ast.Node) {
 	}
 }
 
-func loadFile(fileName string, env interpreter.Env, standardReadLine func() string) {
+func loadFile(fileName string, in *interpreter.Interpreter) {
 	if len(fileName) > 0 {
 		content, err := util.ReadFile(fileName)
 		if err != nil {
 			fmt.Printf("Error while loading file <%v>: %v\n", fileName, err.Error())
 		} else {
-			interpreter.ParseEvalPrint(env, content, standardReadLine, fileName, false)
+			if _, err := in.ParseEvalContext(context.Background(), content, fileName, limits); err != nil {
+				in.PrintError(err)
+			}
 		}
 	}
 }
@@ -3,17 +3,24 @@
 (def defproc
   (macro
     (proc (name args &rest exps)
-      (list 'def name
-        (list 'proc args
-          (cons 'begin exps))))))
+      `(def ,name
+         (proc ,args
+           (begin ,@exps))))))
 
 (def defmacro
   (macro
     (proc (name args body)
-      (list 'def name
-        (list 'macro
-          (list 'proc args
-            body))))))
+      `(def ,name
+         (macro
+           (proc ,args
+             ,body))))))
+
+(def defsyntax
+  (macro
+    (proc (name literals &rest rules)
+      `(def ,name
+         (syntax-rules ,literals
+           ,@rules)))))
 
 ;;;;;;;;;; Math
 
@@ -101,6 +108,9 @@
 (defproc string? (n)
   (= (typeof n) 'string))
 
+(defproc error? (n)
+  (= (typeof n) 'error))
+
 (defproc atom? (n)
   (not (list? n)))
 
@@ -120,8 +130,8 @@
 ;; (cond (= a b) (typeof a)
 ;;       true    (typeof b))
 (defmacro if2 (condition consequent alternative)
-  (list 'cond condition consequent
-              true      alternative))
+  `(cond ,condition ,consequent
+         true       ,alternative))
 
 ;;;;;;;;;;
 
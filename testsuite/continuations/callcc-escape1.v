@@ -0,0 +1,14 @@
+(def find-first
+  (proc (pred xs)
+    (call/cc
+      (proc (return)
+        (let (loop (proc (ys)
+                     (cond (= ys '()) nil
+                           (pred (first ys)) (return (first ys))
+                           true (loop (rest ys)))))
+          (begin
+            (loop xs)
+            'not-found))))))
+
+(println (find-first (proc (x) (> x 2)) '(1 2 3 4)))
+(find-first (proc (x) (> x 10)) '(1 2 3 4))
@@ -0,0 +1,39 @@
+; A generator built from two continuations: one to resume the producer and
+; one to return to the consumer.
+
+(def return-to-consumer nil)
+(def resume-producer nil)
+(def started false)
+
+(def produce
+  (proc (x)
+    (call/cc
+      (proc (k)
+        (begin
+          (update! resume-producer k)
+          (return-to-consumer x))))))
+
+(def producer
+  (proc ()
+    (begin
+      (produce 1)
+      (produce 2)
+      (produce 3)
+      (return-to-consumer 'done))))
+
+(def next-value
+  (proc ()
+    (call/cc
+      (proc (k)
+        (begin
+          (update! return-to-consumer k)
+          (if started
+            (resume-producer nil)
+            (begin
+              (update! started true)
+              (producer))))))))
+
+(println (next-value))
+(println (next-value))
+(println (next-value))
+(next-value)
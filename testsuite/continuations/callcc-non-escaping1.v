@@ -0,0 +1 @@
+(+ 1 (call/cc (proc (k) 41)))
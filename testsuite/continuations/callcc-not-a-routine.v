@@ -0,0 +1 @@
+(call/cc 42)
@@ -0,0 +1,9 @@
+(def saved nil)
+(def counter 0)
+
+(begin
+  (println (list 'a (call/cc (proc (k) (begin (update! saved k) 0))) 'b))
+  (update! counter (+ counter 1))
+  (if (< counter 3)
+    (saved counter)
+    counter))
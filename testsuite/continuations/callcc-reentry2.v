@@ -0,0 +1,10 @@
+; Re-entering a continuation captured while evaluating an argument leaves the
+; lists built by earlier returns to it as they were
+(def saved nil)
+(def results nil)
+
+(begin
+  (update! results (cons (list 'a (call/cc (proc (k) (begin (update! saved k) 0))) 'b) results))
+  (if (< (len results) 3)
+    (saved (len results))
+    results))
@@ -0,0 +1 @@
+(call/cc (proc (k) (typeof k)))
@@ -0,0 +1 @@
+(+ 100 (call/cc (proc (k) (begin (apply k '(5)) 1))))
@@ -0,0 +1,13 @@
+; 'and' and 'or' are procedures from the prelude, which return true or false
+(load "prelude.v")
+
+(list
+  (and)
+  (or)
+  (and true true)
+  (and 1 2 3)
+  (or nil 5)
+  (or false true)
+  (or true (println "evaluated"))
+  (apply and (list true true))
+  (let (f or) (f false true)))
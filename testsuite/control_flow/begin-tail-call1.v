@@ -0,0 +1,13 @@
+; The last form of a begin is in tail position, so the calls of the loop do not
+; pile up on the stack
+(def loop
+  (proc (i)
+    (begin
+      nil
+      (if (= i 100)
+        (raise "done")
+        (loop (+ i 1))))))
+
+(try
+  (loop 0)
+  (catch e (len (error-stack e))))
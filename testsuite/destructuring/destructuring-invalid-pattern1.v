@@ -0,0 +1,2 @@
+(let ((a 1) (list 1 2))
+  a)
@@ -0,0 +1,2 @@
+(let ((a b &rest c) (list 1))
+  a)
@@ -0,0 +1,5 @@
+(def f
+  (proc ((x y))
+    (+ x y)))
+
+(f (list 1 2 3))
@@ -0,0 +1,2 @@
+(let ((a (b c)) (list 1 2))
+  a)
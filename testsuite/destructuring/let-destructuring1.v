@@ -0,0 +1,6 @@
+(def pair (list 1 2))
+
+(let ((a b) pair
+      (c (d &rest e)) (list a (list b 3 4))
+      total (+ a b))
+  (list a b c d e total))
@@ -0,0 +1,18 @@
+(def f
+  (proc ((x y) &rest more)
+    (list x y more)))
+
+(def g
+  (proc (a (b (c d)) &rest (e f))
+    (list a b c d e f)))
+
+(def h
+  (proc ((head &rest tail))
+    (list head tail)))
+
+(list
+  (f (list 1 2) 3 4)
+  (g 1 (list 2 (list 3 4)) 5 6)
+  (h '(1 2 3))
+  (h "abc")
+  (routine-arity f))
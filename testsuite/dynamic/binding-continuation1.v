@@ -0,0 +1,9 @@
+; Escaping from a binding form with a continuation undoes the rebinding
+(defdynamic *x* 'root)
+
+(list
+  (call/cc
+    (proc (return)
+      (binding (*x* 'inner)
+        (return *x*))))
+  *x*)
@@ -0,0 +1,9 @@
+; The rebinding is undone when an error unwinds out of the binding form
+(defdynamic *x* 'root)
+
+(list
+  (try
+    (binding (*x* 'inner)
+      (undefined-procedure))
+    (catch e *x*))
+  *x*)
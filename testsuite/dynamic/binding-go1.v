@@ -0,0 +1,13 @@
+; Threads started with go see the bindings in place when they were started,
+; but their updates to them are not seen by other threads
+(defdynamic *x* 'root)
+
+(def c1 (chan))
+(def c2 (chan))
+
+(binding (*x* 'outer)
+  (go (send! c1 *x*))
+  (go
+    (update! *x* 'changed-in-go)
+    (send! c2 *x*))
+  (list (take! c1) (take! c2) *x*))
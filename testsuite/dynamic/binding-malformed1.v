@@ -0,0 +1,4 @@
+(defdynamic *x* 1)
+
+(binding (*x*)
+  *x*)
@@ -0,0 +1,4 @@
+(def x 1)
+
+(binding (x 2)
+  x)
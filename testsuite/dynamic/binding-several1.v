@@ -0,0 +1,7 @@
+; The values are all evaluated before any of the variables are rebound
+(defdynamic *a* 1)
+(defdynamic *b* 2)
+
+(binding (*a* 10
+          *b* *a*)
+  (list *a* *b*))
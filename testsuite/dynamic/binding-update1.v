@@ -0,0 +1,12 @@
+(defdynamic *trace* false)
+
+(def results
+  (list
+    (binding (*trace* true)
+      (update! *trace* 'changed)
+      *trace*)
+    *trace*))
+
+(update! *trace* 'root-changed)
+
+(list results *trace*)
@@ -0,0 +1,12 @@
+(defdynamic *depth* 0)
+
+(def show-depth (proc () *depth*))
+
+(list
+  (show-depth)
+  (binding (*depth* 1)
+    (show-depth))
+  (binding (*depth* 1)
+    (binding (*depth* (+ *depth* 1))
+      (show-depth)))
+  (show-depth))
@@ -0,0 +1,12 @@
+; Runaway recursion raises an error which can be caught like any other, with
+; every call in progress on the stack
+(def deep
+  (proc (n)
+    (+ 1 (deep (+ n 1)))))
+
+(try
+  (deep 0)
+  (catch err
+    (list (error-message err)
+          (len (error-stack err))
+          (first (error-stack err)))))
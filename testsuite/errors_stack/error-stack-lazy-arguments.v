@@ -0,0 +1,10 @@
+; Lazy sequences in the arguments of a frame are described by the elements
+; realized so far, without realizing any more of them
+(def naturals (range))
+(first (rest naturals))
+
+(def f (proc (xs) (raise "failed")))
+
+(try
+  (f naturals)
+  (catch e (first (error-stack e))))
@@ -0,0 +1,6 @@
+(def f (proc (xs) (first)))
+
+(try
+  (f '(1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 20 21 22 23 24 25))
+  (catch err
+    (first (error-stack err))))
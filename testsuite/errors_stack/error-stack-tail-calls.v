@@ -0,0 +1,11 @@
+; Tail calls replace the frame of their caller
+(def countdown
+  (proc (n)
+    (if (> n 0)
+      (countdown (- n 1))
+      (raise "done counting"))))
+
+(try
+  (countdown 1000)
+  (catch err
+    (len (error-stack err))))
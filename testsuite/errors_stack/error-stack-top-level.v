@@ -0,0 +1,4 @@
+(try
+  (raise "at the top")
+  (catch err
+    (error-stack err)))
@@ -0,0 +1,8 @@
+(def inner (proc (x) (+ x 'oops)))
+(def middle (proc (x) (* 2 (inner x))))
+(def outer (proc () (+ 1 (middle 5))))
+
+(try
+  (outer)
+  (catch err
+    (error-stack err)))
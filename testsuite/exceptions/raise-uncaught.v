@@ -0,0 +1,3 @@
+(println 1)
+(raise "not handled" 42)
+(println 2)
@@ -0,0 +1,4 @@
+(println (try undefined-name (catch err (error-message err))))
+(println (try (+ 1 'a) (catch err (error-message err))))
+(println (try (first 1 2) (catch err (error-message err))))
+(try ((proc (a) a)) (catch err err))
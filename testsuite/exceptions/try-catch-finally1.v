@@ -0,0 +1,14 @@
+(def attempt
+  (proc (x)
+    (try
+      (if (= x 0)
+        (raise "zero" x)
+        (/ 10 x))
+      (catch err
+        (println "caught" (error-message err) "with data" (error-data err))
+        -1)
+      (finally
+        (println "finally for" x)))))
+
+(println (attempt 2))
+(println (attempt 0))
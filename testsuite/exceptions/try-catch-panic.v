@@ -0,0 +1,3 @@
+(try
+  (panic "oh" "no")
+  (catch err (list (typeof err) (error-message err))))
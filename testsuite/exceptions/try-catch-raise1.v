@@ -0,0 +1,7 @@
+(try
+  (println "before")
+  (raise "something went wrong")
+  (println "not reached")
+  (catch err
+    (println "caught:" (error-message err))
+    'recovered))
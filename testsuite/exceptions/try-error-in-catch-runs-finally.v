@@ -0,0 +1,6 @@
+(try
+  (raise "first")
+  (catch err
+    (raise (str "second after " (error-message err))))
+  (finally
+    (println "finally ran")))
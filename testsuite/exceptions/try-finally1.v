@@ -0,0 +1,13 @@
+(println
+  (try
+    (println "body")
+    1
+    (finally
+      (println "cleanup")
+      2)))
+
+(try
+  (try
+    (raise "inner")
+    (finally (println "cleanup after error")))
+  (catch err (error-message err)))
@@ -0,0 +1,11 @@
+(def result
+  (try
+    (try
+      (raise "deep" '(1 2 3))
+      (catch err
+        (println "inner handler sees" (error-message err))
+        (raise err)))
+    (catch outer
+      (list (error-message outer) (error-data outer) (error-location outer)))))
+
+result
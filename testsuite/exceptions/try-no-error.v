@@ -0,0 +1 @@
+(list (try) (try 1 2 3) (try 4 (catch e 5)))
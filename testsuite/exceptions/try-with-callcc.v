@@ -0,0 +1,12 @@
+; Escaping out of a try body with a continuation must not leave its error
+; handler installed.
+(try
+  (begin
+    (println
+      (call/cc
+        (proc (k)
+          (try
+            (k 'escaped)
+            (catch err (println "wrongly caught"))))))
+    (raise "after escape"))
+  (catch err (error-message err)))
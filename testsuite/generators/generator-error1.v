@@ -0,0 +1,9 @@
+; An error raised by the body reaches the consumer
+(def g
+  (generator
+    (yield 1)
+    (raise "broken generator")))
+
+(try
+  (len g)
+  (catch e (list (first g) (error-message e))))
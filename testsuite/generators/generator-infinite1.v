@@ -0,0 +1,10 @@
+; The consumer pulls values one at a time, and may stop whenever it likes
+(def fibonacci
+  (generator
+    (let (loop (proc (a b)
+                 (begin
+                   (yield a)
+                   (loop b (+ a b)))))
+      (loop 0 1))))
+
+(take 10 fibonacci)
@@ -0,0 +1,20 @@
+; A yield may come from a procedure called by the body of a generator
+(def yield-all
+  (proc (xs)
+    (if (= xs '())
+      nil
+      (begin
+        (yield (first xs))
+        (yield-all (rest xs))))))
+
+(def g
+  (generator
+    (yield-all (list 1 2))
+    (yield 'middle)
+    (yield-all (list 3 4))))
+
+(list
+  g
+  (generator)
+  (generator (yield))
+  (first (generator (yield (first (generator (yield 'inner)))))))
@@ -0,0 +1,15 @@
+; The body only runs as far as is needed for the values pulled so far
+(def g
+  (generator
+    (println "starting")
+    (yield 'a)
+    (println "after a")
+    (yield 'b)
+    (println "after b")))
+
+(def x (first g))
+(println "got" x)
+(def y (first (rest g)))
+(println "got" y)
+(def z (rest (rest g)))
+(println "finished" (= z '()))
@@ -0,0 +1,12 @@
+; Error handlers established in the body are in place when it resumes after a
+; yield
+(def g
+  (generator
+    (try
+      (begin
+        (yield 1)
+        (raise "inside"))
+      (catch e
+        (yield (error-message e))))))
+
+g
@@ -0,0 +1,7 @@
+(def g
+  (generator
+    (yield 1)
+    (yield 2)
+    (yield 3)))
+
+(list (first g) (rest g) (len g) g)
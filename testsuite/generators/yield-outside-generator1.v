@@ -0,0 +1 @@
+(yield 1)
@@ -0,0 +1,12 @@
+; The macro's 'tmp' does not capture the caller's 'tmp'
+(def my-or
+  (syntax-rules ()
+    ((_ a b)
+     (let (tmp a)
+       (if tmp tmp b)))))
+
+(def tmp 5)
+
+(list
+  (my-or false tmp)
+  (my-or 1 tmp))
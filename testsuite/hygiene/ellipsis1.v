@@ -0,0 +1,20 @@
+(def my-list
+  (syntax-rules ()
+    ((_ x ...) (list x ...))))
+
+(def my-let*
+  (syntax-rules ()
+    ((_ () body) body)
+    ((_ (name value rest ...) body)
+     (let (name value)
+       (my-let* (rest ...) body)))))
+
+(def pairs
+  (syntax-rules ()
+    ((_ (a b) ...) (list (list b a) ...))))
+
+(list
+  (my-list)
+  (my-list 1 2 3)
+  (my-let* (a 1 b (+ a 1)) (list a b))
+  (pairs (1 2) (3 4)))
@@ -0,0 +1,18 @@
+; The names the macro refers to are those of its definition, even if the
+; caller binds the same names
+(def counter 0)
+
+(def count!
+  (syntax-rules ()
+    ((_) (update! counter (+ counter 1)))))
+
+(def current
+  (syntax-rules ()
+    ((_) counter)))
+
+(let (counter 100
+      + (proc (a b) 0))
+  (begin
+    (count!)
+    (count!)
+    (list counter (current))))
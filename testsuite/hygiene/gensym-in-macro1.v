@@ -0,0 +1,10 @@
+(def my-or
+  (macro
+    (proc (a b)
+      (let (tmp (gensym))
+        `(let (,tmp ,a)
+           (if ,tmp ,tmp ,b))))))
+
+(def tmp 5)
+
+(my-or false tmp)
@@ -0,0 +1,16 @@
+; The names given to a macro's bindings cannot be written in source, so they
+; cannot capture a name of the caller's, however it is spelled
+(def my-or
+  (syntax-rules ()
+    ((_ a b)
+     (let (tmp a)
+       (if tmp tmp b)))))
+
+(def tmp__1 1)
+(def tmp__2 2)
+(def tmp__3 3)
+
+(list
+  (my-or false tmp__1)
+  (my-or false tmp__2)
+  (my-or false tmp__3))
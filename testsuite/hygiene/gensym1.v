@@ -0,0 +1,7 @@
+(def a (gensym))
+(def b (gensym "tmp"))
+
+(list
+  (typeof a)
+  (= a b)
+  (= a a))
@@ -0,0 +1,9 @@
+(def arrow
+  (syntax-rules (=>)
+    ((_ a => b) (list 'forward a b))
+    ((_ a b c) (list 'other a b c))))
+
+(list
+  (arrow 1 => 2)
+  (arrow 1 2 3)
+  (arrow 'x 'y 'z))
@@ -0,0 +1,5 @@
+(def two
+  (syntax-rules ()
+    ((_ a b) (list a b))))
+
+(two 1)
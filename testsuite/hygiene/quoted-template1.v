@@ -0,0 +1,6 @@
+; Quoted symbols in a template are not renamed
+(def name-of
+  (syntax-rules ()
+    ((_ x) (list 'name x `(y ,x)))))
+
+(name-of 1)
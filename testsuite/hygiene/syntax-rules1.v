@@ -0,0 +1,13 @@
+(def swap!
+  (syntax-rules ()
+    ((_ a b)
+     (let (tmp a)
+       (begin
+         (update! a b)
+         (update! b tmp))))))
+
+(def x 1)
+(def y 2)
+(swap! x y)
+
+(list x y)
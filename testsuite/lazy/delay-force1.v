@@ -0,0 +1,3 @@
+(def p (delay (begin (println "evaluating") 42)))
+
+(list (typeof p) (force p) (force p) (force 7))
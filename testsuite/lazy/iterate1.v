@@ -0,0 +1,3 @@
+(list
+  (take 6 (iterate (proc (x) (* x 2)) 1))
+  (first (drop 3 (iterate (proc (s) (concat s "a")) ""))))
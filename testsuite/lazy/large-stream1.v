@@ -0,0 +1,4 @@
+; A long stream can be walked without building it up front
+(list
+  (first (drop 200000 (range)))
+  (first (drop 1000 (lazy-map (proc (x) (+ x 1)) (range)))))
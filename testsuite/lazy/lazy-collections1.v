@@ -0,0 +1,13 @@
+(def s (take 3 (range)))
+
+(list
+  (len s)
+  (first s)
+  (rest s)
+  (cons 'a s)
+  (concat s (list 3 4))
+  (first (concat (range) (list 'never)))
+  (= s (list 0 1 2))
+  (= (list 0 1 2) s)
+  (= s (list 0 1))
+  (= (take 0 s) '()))
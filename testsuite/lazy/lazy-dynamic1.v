@@ -0,0 +1,9 @@
+; A lazy sequence is realized with the dynamic bindings in place where it was
+; created
+(defdynamic *scale* 1)
+
+(def scaled
+  (binding (*scale* 10)
+    (lazy-map (proc (x) (* x *scale*)) (range 3))))
+
+scaled
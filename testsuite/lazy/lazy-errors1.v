@@ -0,0 +1,6 @@
+; An error raised while realizing a sequence can be caught
+(def s (lazy-map (proc (x) (raise "bad element" x)) (list 1 2)))
+
+(try
+  (first s)
+  (catch e (list (error-message e) (error-data e))))
@@ -0,0 +1,12 @@
+; Only the elements which are needed are computed, and each only once
+(def squares
+  (lazy-map
+    (proc (x)
+      (begin
+        (println "squaring" x)
+        (* x x)))
+    (range)))
+
+(def third (first (rest (rest squares))))
+
+(list third (first squares))
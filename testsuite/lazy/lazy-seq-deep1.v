@@ -0,0 +1,11 @@
+; A lazy sequence needed while another is being realized counts towards the
+; limit on depth, so runaway recursion through lazy sequences raises an error
+; rather than overflowing the stack
+(def nested
+  (proc (n)
+    (lazy-seq (list (first (nested (+ n 1)))))))
+
+(try
+  (first (nested 0))
+  (catch err
+    (error-message err)))
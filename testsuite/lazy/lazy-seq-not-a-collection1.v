@@ -0,0 +1,3 @@
+(def s (lazy-seq 5))
+
+(first s)
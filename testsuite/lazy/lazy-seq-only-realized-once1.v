@@ -0,0 +1,3 @@
+(def s (lazy-seq (begin (println "realizing") (list 1 2 3))))
+
+(list (first s) (first s) (len s))
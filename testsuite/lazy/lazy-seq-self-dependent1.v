@@ -0,0 +1,7 @@
+; A lazy sequence which is needed while it is being realized raises an error
+; rather than waiting for itself, and is realized again the next time
+(def t (lazy-seq (if (first t) (list 1) (list 2))))
+
+(list
+  (try (first t) (catch e (error-message e)))
+  (try (first t) (catch e (error-message e))))
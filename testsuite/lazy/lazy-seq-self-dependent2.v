@@ -0,0 +1,3 @@
+(def t (lazy-seq t))
+
+(first t)
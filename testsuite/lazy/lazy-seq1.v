@@ -0,0 +1,12 @@
+(def naturals-from
+  (proc (n)
+    (lazy-seq (cons n (naturals-from (+ n 1))))))
+
+(def naturals (naturals-from 0))
+
+(list
+  (typeof naturals)
+  (take 5 naturals)
+  (first (rest (rest naturals)))
+  (lazy-seq '())
+  (lazy-seq (list 1 2)))
@@ -0,0 +1,7 @@
+(list
+  (range 5)
+  (range 2 6)
+  (range 0 10 3)
+  (range 5 0 -2)
+  (range 3 3)
+  (take 3 (range)))
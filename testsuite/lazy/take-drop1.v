@@ -0,0 +1,7 @@
+(list
+  (take 2 (list 1 2 3))
+  (take 5 (list 1 2))
+  (take 0 (range))
+  (drop 2 (list 1 2 3))
+  (drop 5 (list 1 2))
+  (take 3 (drop 10 (range))))
@@ -0,0 +1,2 @@
+(match (list 1 1)
+  (a a) a)
@@ -0,0 +1,16 @@
+(def eval-expr
+  (proc (e)
+    (match e
+      ('quote x) x
+      ('if c t f) (if (eval-expr c) (eval-expr t) (eval-expr f))
+      ('+ a b) (+ (eval-expr a) (eval-expr b))
+      ('list &rest xs) (len xs)
+      ((a b) c) (list 'nested a b c)
+      x x)))
+
+(list
+  (eval-expr '(quote (1 2)))
+  (eval-expr '(if true (+ 1 2) 0))
+  (eval-expr '(list 1 2 3))
+  (eval-expr '((1 2) 3))
+  (eval-expr 7))
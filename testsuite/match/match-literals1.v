@@ -0,0 +1,22 @@
+(def describe
+  (proc (x)
+    (match x
+      0 'zero
+      "s" 'the-string
+      \c 'the-char
+      nil 'nil
+      true 'true
+      'sym 'quoted-symbol
+      '(1 2) 'quoted-list
+      _ 'other)))
+
+(list
+  (describe 0)
+  (describe "s")
+  (describe \c)
+  (describe nil)
+  (describe true)
+  (describe 'sym)
+  (describe (list 1 2))
+  (describe 'other)
+  (describe false))
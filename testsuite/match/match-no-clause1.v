@@ -0,0 +1,5 @@
+(def x 5)
+
+(match x
+  1 'one
+  2 'two)
@@ -0,0 +1,3 @@
+(match 1
+  1 'one
+  2)
@@ -0,0 +1,20 @@
+(def number? (proc (x) (= (typeof x) 'number)))
+(def string? (proc (x) (= (typeof x) 'string)))
+
+(def classify
+  (proc (x)
+    (match x
+      (when (? number? n) (< n 0)) (list 'negative n)
+      (? number? n) (list 'number n)
+      (? string?) 'string
+      (when (a b) (= a b)) (list 'same a)
+      (a b) (list 'pair a b)
+      _ 'unknown)))
+
+(list
+  (classify -5)
+  (classify 5)
+  (classify "s")
+  (classify (list 1 1))
+  (classify (list 1 2))
+  (classify 'sym))
@@ -0,0 +1,9 @@
+; Variables are bound in a new environment for each clause, so a clause which
+; fails part way through leaves nothing behind
+(def x 'outer)
+
+(list
+  (match (list 1 2)
+    (x 3) x
+    (y z) (list x y z))
+  x)
@@ -0,0 +1,12 @@
+(def scale 10)
+
+(def make-scaler
+  (proc (factor)
+    (proc (x &optional (by (* factor scale)))
+      (* x by))))
+
+(def by-20 (make-scaler 2))
+
+(list
+  (by-20 3)
+  (by-20 3 1))
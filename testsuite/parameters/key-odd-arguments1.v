@@ -0,0 +1,5 @@
+(def f
+  (proc (&key a b)
+    a))
+
+(f 'a)
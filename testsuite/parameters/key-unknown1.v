@@ -0,0 +1,5 @@
+(def f
+  (proc (&key (name "x"))
+    name))
+
+(f 'nmae "y")
@@ -0,0 +1,10 @@
+(def make-user
+  (proc (id &key (name "x") (admin false) email)
+    (list id name admin email)))
+
+(list
+  (make-user 1)
+  (make-user 1 'admin true)
+  (make-user 1 'email "a@b" 'name "ann")
+  (routine-arity make-user)
+  (routine-params make-user))
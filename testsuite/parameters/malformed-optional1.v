@@ -0,0 +1,5 @@
+(def f
+  (proc (&optional (a 1 2))
+    a))
+
+(f)
@@ -0,0 +1,8 @@
+(def f
+  (proc (a &optional (b 2) &key (c (+ a b)))
+    (list a b c)))
+
+(list
+  (f 1)
+  (f 1 5)
+  (f 1 5 'c 0))
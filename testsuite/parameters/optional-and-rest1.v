@@ -0,0 +1,9 @@
+(def f
+  (proc (a &optional (b 'none) &rest more)
+    (list a b more)))
+
+(list
+  (f 1)
+  (f 1 2)
+  (f 1 2 3 4)
+  (routine-arity f))
@@ -0,0 +1,5 @@
+(def f
+  (proc (a &optional b)
+    a))
+
+(f 1 2 3)
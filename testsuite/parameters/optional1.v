@@ -0,0 +1,10 @@
+(def connect
+  (proc (host &optional (port 80) (timeout (* port 10)) flag)
+    (list host port timeout flag)))
+
+(list
+  (connect "a")
+  (connect "a" 8080)
+  (connect "a" 8080 5)
+  (connect "a" 8080 5 true)
+  (routine-arity connect))
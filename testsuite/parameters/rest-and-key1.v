@@ -0,0 +1,5 @@
+(def f
+  (proc (&rest xs &key a)
+    a))
+
+(f)
@@ -0,0 +1,12 @@
+(println
+  (list
+    (go-type 4)
+    (go-type "foo")
+    (go-type \a)
+    (go-type true)
+    (go-type nil)
+    (go-type '(1 2))
+    (go-type 'foo)
+    (go-type (try (raise "oops") (catch err err)))))
+(println (try (go-call 4 'String) (catch err (error-message err))))
+(try (go-field "foo" 'Name) (catch err (error-message err)))
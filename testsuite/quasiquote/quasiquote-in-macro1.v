@@ -0,0 +1,11 @@
+(def my-defproc
+  (macro
+    (proc (name args &rest exps)
+      `(def ,name (proc ,args (begin ,@exps))))))
+
+(my-defproc add3 (a b c)
+  (+ a (+ b c)))
+
+(list
+  (add3 1 2 3)
+  (macroexpand1 '(my-defproc f (x) x 1)))
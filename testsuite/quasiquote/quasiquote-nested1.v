@@ -0,0 +1,6 @@
+(def x 1)
+
+(list
+  `(a `(b ,(c ,x)))
+  `(a `(b ,,x))
+  `(a `(b ,@(c ,@(list x x)))))
@@ -0,0 +1,12 @@
+(def x 1)
+(def xs (list 2 3))
+
+(list
+  `a
+  `(a b c)
+  `(a ,x)
+  `(a ,@xs b)
+  `(a (nested ,x ,@xs))
+  `(,@xs)
+  `(a ,@'() b)
+  `(a ,(+ x 10)))
@@ -0,0 +1,2 @@
+(def x 1)
+,x
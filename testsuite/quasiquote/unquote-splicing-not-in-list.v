@@ -0,0 +1,2 @@
+(def xs (list 1 2))
+`,@xs
@@ -0,0 +1,20 @@
+; Names defined at run time in the environment of a procedure call are found
+; alongside its parameters
+(def f
+  (proc (a)
+    (let (b (+ a 1))
+      (begin
+        (eval '(def c (* a 10)) (current-environment))
+        (list a b c (eval '(+ b c) (current-environment)))))))
+(println (f 1))
+
+; A let variable is not visible in its own value, nor in the values before it
+(def g (proc (x) (let (y x x 10 z x) (list x y z))))
+(println (g 1))
+
+(def counter
+  (let (n 0)
+    (proc ()
+      (begin (update! n (+ n 1)) n))))
+(counter)
+(counter)
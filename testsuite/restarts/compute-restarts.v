@@ -0,0 +1,7 @@
+(println (compute-restarts))
+(restart-case
+  (restart-case
+    (compute-restarts)
+    (retry () 1))
+  (skip () 2)
+  (use-value (v) v))
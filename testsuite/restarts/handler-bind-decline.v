@@ -0,0 +1,9 @@
+; A handler which returns normally declines, passing the error outwards
+(try
+  (handler-bind
+    (proc (err) (println "inner handler saw:" (error-message err)))
+    (handler-bind
+      (proc (err) (println "innermost handler saw:" (error-message err)))
+      (raise "oops")))
+  (catch err
+    (str "caught " (error-message err))))
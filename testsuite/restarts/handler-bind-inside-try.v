@@ -0,0 +1,6 @@
+; An inner try catches an error before an outer handler sees it
+(handler-bind
+  (proc (err) (println "should not be called"))
+  (try
+    (raise "inner")
+    (catch err (error-message err))))
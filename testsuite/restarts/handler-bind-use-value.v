@@ -0,0 +1,4 @@
+; A handler can continue past an undefined name by supplying a value for it
+(handler-bind
+  (proc (err) (invoke-restart 'use-value 42))
+  (+ 1 undefined-name))
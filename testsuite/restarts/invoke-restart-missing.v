@@ -0,0 +1 @@
+(invoke-restart 'no-such-restart)
@@ -0,0 +1,3 @@
+(list
+  (restart-case 5 (use-value (v) v))
+  (compute-restarts))
@@ -0,0 +1,30 @@
+; Low-level code offers restarts; the caller decides how to continue.
+
+(def parse-entry
+  (proc (x)
+    (restart-case
+      (if (number? x)
+        x
+        (raise "Not a number" x))
+      (skip () nil)
+      (use-value (v) v))))
+
+(def number? (proc (x) (= (typeof x) 'number)))
+
+(def parse-all
+  (proc (xs)
+    (if (= xs '())
+      '()
+      (let (parsed (parse-entry (first xs)))
+        (if (= parsed nil)
+          (parse-all (rest xs))
+          (cons parsed (parse-all (rest xs))))))))
+
+(println
+  (handler-bind
+    (proc (err) (invoke-restart 'skip))
+    (parse-all '(1 a 2 b 3))))
+
+(handler-bind
+  (proc (err) (invoke-restart 'use-value 99))
+  (parse-all '(1 a 2 b 3)))
@@ -0,0 +1,9 @@
+; The handler defines the missing name, then retries looking it up
+(def top (current-environment))
+
+(handler-bind
+  (proc (err)
+    (begin
+      (eval '(def late-name 10) top)
+      (invoke-restart 'retry)))
+  (* late-name 2))
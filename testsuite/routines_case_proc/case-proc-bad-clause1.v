@@ -0,0 +1,3 @@
+(case-proc
+  ((a) a)
+  (b))
@@ -0,0 +1,9 @@
+(def make-counter
+  (proc (start)
+    (case-proc
+      (() start)
+      ((n) (+ start n)))))
+
+(def c (make-counter 10))
+
+(list (c) (c 5))
@@ -0,0 +1,15 @@
+; Clauses are tried in order of their arities, and may use any kind of
+; parameters
+(def describe
+  (case-proc
+    (() 'none)
+    (((a b) c) (list 'pair a b c))
+    ((x &optional (y 'default)) (list 'one-or-two x y))
+    ((x y z &rest more) (list 'many x y z more))))
+
+(list
+  (describe)
+  (describe 1)
+  (describe (list 1 2) 3)
+  (describe 1 2 3 4)
+  (routine-arity describe))
@@ -0,0 +1,7 @@
+(def f
+  (case-proc
+    ((a) a)
+    ((a b c) c)
+    ((a b c d &rest e) e)))
+
+(f 1 2)
@@ -0,0 +1,16 @@
+(def numbers
+  (case-proc
+    ((n) (numbers 0 n))
+    ((a b) (numbers a b 1))
+    ((a b step)
+     (if (< a b)
+       (cons a (numbers (+ a step) b step))
+       '()))))
+
+(list
+  (numbers 3)
+  (numbers 2 5)
+  (numbers 0 10 3)
+  (routine-arity numbers)
+  (routine-params numbers)
+  (routine-body (case-proc ((x) x) ((x y) y))))
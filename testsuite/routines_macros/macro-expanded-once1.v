@@ -0,0 +1,20 @@
+; A macro call is expanded the first time it is evaluated, and its expansion
+; is reused after that
+(def expansions 0)
+
+(def twice
+  (macro
+    (proc (x)
+      (begin
+        (update! expansions (+ expansions 1))
+        (list '+ x x)))))
+
+(def loop
+  (proc (n acc)
+    (if (= n 0)
+      acc
+      (loop (- n 1) (+ acc (twice n))))))
+
+(list
+  (loop 5 0)
+  expansions)
@@ -0,0 +1,9 @@
+; A call site is expanded again if its head refers to a different macro
+(def m (macro (proc () ''first)))
+
+(def f (proc () (m)))
+
+(def before (f))
+(update! m (macro (proc () ''second)))
+
+(list before (f))
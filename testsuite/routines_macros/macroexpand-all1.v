@@ -0,0 +1,16 @@
+(def my-when
+  (macro
+    (proc (condition body)
+      (list 'if condition body nil))))
+
+(def my-unless
+  (macro
+    (proc (condition body)
+      (list 'my-when (list 'not condition) body))))
+
+(list
+  (macroexpand-all '(my-unless a (my-when b c)))
+  (macroexpand-all '(proc (x) (my-when x '(my-when y z))))
+  (macroexpand-all '(proc (my-when) (my-when 1 2)))
+  (macroexpand-all '(let (a (my-when 1 2)) (my-unless a 3)))
+  (macroexpand-all 5))
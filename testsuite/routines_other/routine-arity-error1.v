@@ -0,0 +1,4 @@
+(def f
+  (proc (a &rest more) a))
+
+(f)
@@ -0,0 +1,6 @@
+(list
+  (routine-arity (proc (a b) a))
+  (routine-arity (proc (a &rest more) a))
+  (routine-arity (proc () 1))
+  (routine-arity first)
+  (routine-arity list))
@@ -0,0 +1,14 @@
+(def f
+  (proc (a b) (+ a b)))
+
+(def defproc2
+  (macro
+    (proc (name params body)
+      (list 'def name (list 'proc params body)))))
+
+(defproc2 g (x) x)
+
+(list
+  (routine-location f)
+  (routine-location g)
+  (routine-location first))
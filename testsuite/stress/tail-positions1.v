@@ -0,0 +1,18 @@
+; A million iterations through let, begin, cond and apply, all in tail
+; position. The loop raises an error at the end, whose stack shows that
+; the calls did not pile up.
+(def n 1000000)
+
+(def loop
+  (proc (i)
+    (let (j (+ i 1))
+      (begin
+        nil
+        (cond
+          (= j n) (raise "done" j)
+          true    (apply loop (list j)))))))
+
+(try
+  (loop 0)
+  (catch e
+    (list (error-data e) (len (error-stack e)))))
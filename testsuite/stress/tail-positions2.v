@@ -0,0 +1,26 @@
+; A million iterations through a macro expansion, match and a procedure with
+; several arities, with the call to the other procedure of a mutual recursion
+; in tail position
+(def n 1000000)
+
+(def unless
+  (macro
+    (proc (condition body)
+      (list 'if condition nil body))))
+
+(def ping
+  (case-proc
+    ((i) (ping i 'ping))
+    ((i tag)
+     (match i
+       (? (proc (x) (= x n))) (raise "done" (list i tag))
+       _ (unless (= i n) (pong (+ i 1)))))))
+
+(def pong
+  (proc (i)
+    (ping i)))
+
+(try
+  (ping 0)
+  (catch e
+    (list (error-data e) (len (error-stack e)))))
@@ -27,13 +27,11 @@
 ;;          (cons (list "Sample Test" (proc () (begin pred1 pred2 predn...)))
 ;;                _vtest_tests))
 ;;
-(defmacro defvtest (name &rest preds)
-  (list 'update! '_vtest_tests
-    (list 'cons
-      (list 'list name
-        (list 'proc '()
-          (cons 'begin preds)))
-      '_vtest_tests)))
+(defsyntax defvtest ()
+  ((_ name pred ...)
+   (update! _vtest_tests
+     (cons (list name (proc () (begin pred ...)))
+           _vtest_tests))))
 
 (defproc vt= (actual expected)
   (if (= actual expected)